@@ -0,0 +1,61 @@
+// Package atomicfile writes files atomically, so that readers never observe partially written content.
+package atomicfile
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Write writes data to the file at path with the given permissions, creating parent directories as needed.
+//
+// The data is written to a temporary file in the same directory, which then replaces the file.
+// If the file already has the same content, it is not rewritten, and only its permissions are updated.
+// It reports whether the content of the file changed.
+func Write(path string, data []byte, mode fs.FileMode) (bool, error) {
+	existing, err := os.ReadFile(path) //nolint:gosec // Path is explicitly provided by the user.
+	if err == nil && bytes.Equal(existing, data) {
+		if err := os.Chmod(path, mode); err != nil {
+			return false, fmt.Errorf("setting mode of %q: %w", path, err)
+		}
+
+		return false, nil
+	}
+
+	dir := filepath.Dir(path)
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return false, fmt.Errorf("creating directories for %q: %w", path, err)
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return false, fmt.Errorf("creating temporary file for %q: %w", path, err)
+	}
+
+	defer os.Remove(tmp.Name()) //nolint:errcheck // The file is already renamed on success.
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+
+		return false, fmt.Errorf("writing %q: %w", path, err)
+	}
+
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+
+		return false, fmt.Errorf("setting mode of %q: %w", path, err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return false, fmt.Errorf("closing %q: %w", path, err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return false, fmt.Errorf("replacing %q: %w", path, err)
+	}
+
+	return true, nil
+}
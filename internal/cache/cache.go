@@ -0,0 +1,88 @@
+// Package cache stores the outputs of commands on disk, keyed by their inputs.
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Store represents a directory of cached outputs.
+type Store struct {
+	// Dir is the directory the outputs are stored in.
+	Dir string
+}
+
+// Key returns a deterministic key for the given inputs.
+func Key(inputs ...string) string {
+	digest := sha256.Sum256([]byte(strings.Join(inputs, "\x00")))
+
+	return hex.EncodeToString(digest[:])
+}
+
+// Get returns the output stored under the key, if it exists and is not older than the ttl.
+// A ttl of zero never expires.
+func (s Store) Get(key string, ttl time.Duration) (string, bool) {
+	output, stored, ok := s.Stale(key)
+	if !ok || (ttl > 0 && time.Since(stored) > ttl) {
+		return "", false
+	}
+
+	return output, true
+}
+
+// Stale returns the output stored under the key regardless of its age, together with the time it was stored.
+func (s Store) Stale(key string) (string, time.Time, bool) {
+	path := s.path(key)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", time.Time{}, false
+	}
+
+	data, err := os.ReadFile(path) //nolint:gosec // Path is derived from the cache directory and a hex key.
+	if err != nil {
+		return "", time.Time{}, false
+	}
+
+	return string(data), info.ModTime(), true
+}
+
+// Put stores the output under the key, replacing any previous output atomically.
+func (s Store) Put(key, output string) error {
+	if err := os.MkdirAll(s.Dir, 0o700); err != nil {
+		return fmt.Errorf("creating cache directory %q: %w", s.Dir, err)
+	}
+
+	tmp, err := os.CreateTemp(s.Dir, key+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("creating cache file: %w", err)
+	}
+
+	defer os.Remove(tmp.Name()) //nolint:errcheck // The file is already renamed on success.
+
+	if _, err := tmp.WriteString(output); err != nil {
+		tmp.Close()
+
+		return fmt.Errorf("writing cache file: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("closing cache file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.path(key)); err != nil {
+		return fmt.Errorf("storing cache file: %w", err)
+	}
+
+	return nil
+}
+
+// path returns the path of the file storing the output under the key.
+func (s Store) path(key string) string {
+	return filepath.Join(s.Dir, key+".out")
+}
@@ -2,13 +2,21 @@
 package cli
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"slices"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/MakeNowJust/heredoc/v2"
 	"github.com/spf13/cobra"
+
+	"github.com/idelchi/dotgen/internal/tags"
 )
 
 // CLI represents the command-line interface.
@@ -31,14 +39,24 @@ const DefaultEnvFilePath = "**/*.env"
 type Options struct {
 	// Input represents input file paths or patterns.
 	Input []string
+	// Layers represents directories of configuration files laid over each other, in order.
+	Layers []string
 	// Shell represents the active shell.
 	Shell string
+	// Interpreter represents the default interpreter for run commands.
+	Interpreter string
 	// Values represents additional YAML value files.
 	Values []string
 	// EnvFiles represents environment files to load before rendering.
 	EnvFiles []string
 	// Set represents variables to set or override (key=value).
 	Set []string
+	// Tags represents the tag selection terms, such as "work" or "!gui".
+	Tags []string
+	// Selection represents the parsed tag selection.
+	Selection tags.Selection
+	// OnDuplicate represents the policy for commands defined more than once.
+	OnDuplicate string
 	// Verbose represents whether verbose output is enabled.
 	Verbose bool
 	// Debug represents whether debug output is enabled.
@@ -47,6 +65,12 @@ type Options struct {
 	Instrument bool
 	// Parallel represents how many command exports may run at the same time.
 	Parallel int
+	// Prune represents whether to remove exported files that are no longer generated.
+	Prune bool
+	// Timeout represents the time limit for the whole invocation. Zero means no limit.
+	Timeout time.Duration
+	// Refresh represents whether to execute cached "run" commands again instead of reusing their output.
+	Refresh bool
 	// Hash represents whether to compute and print a hash of all included files.
 	Hash bool
 	// Dry represents whether to show which files would be included, but not execute commands.
@@ -76,8 +100,11 @@ func (c CLI) Execute() error {
 			dotgen is a tool to manage and execute named shell commands with Go template substitution.
 
 			Positional Arguments:
-			  patterns               Paths or patterns to dotgen configuration files. Defaults to %q if not specified.
+			  patterns               Paths or patterns to dotgen configuration files.
+			                         Defaults to %q if neither patterns nor layers are specified.
+			                         Patterns named like a subcommand must be written as "./name" or passed after "--".
 		`, DefaultPath),
+		Args:          cobra.ArbitraryArgs,
 		SilenceUsage:  true,
 		SilenceErrors: true,
 		Version:       c.version,
@@ -86,9 +113,12 @@ func (c CLI) Execute() error {
 				return completions(cmd, completion)
 			}
 
-			if len(args) == 0 {
+			switch {
+			case len(args) == 0 && len(options.Layers) > 0:
+				options.Input = []string{}
+			case len(args) == 0:
 				options.Input = []string{DefaultPath}
-			} else {
+			default:
 				options.Input = args
 			}
 
@@ -103,27 +133,69 @@ func (c CLI) Execute() error {
 				return errors.New("parallel must be at least 1")
 			}
 
+			if !slices.Contains(DuplicatePolicies, options.OnDuplicate) {
+				return fmt.Errorf(
+					"invalid --on-duplicate %q, must be one of %v",
+					options.OnDuplicate,
+					DuplicatePolicies,
+				)
+			}
+
+			selection, err := tags.Parse(options.Tags)
+			if err != nil {
+				return err //nolint:wrapcheck // Error is already descriptive enough.
+			}
+
+			options.Selection = selection
+
 			if options.Debug || options.Instrument {
 				options.Verbose = true
 			}
 
 			logger := Logger{Verbose: options.Verbose}
 
-			return logic(options, logger)
+			ctx := cmd.Context()
+
+			if options.Timeout > 0 {
+				var cancel context.CancelFunc
+
+				ctx, cancel = context.WithTimeoutCause(
+					ctx,
+					options.Timeout,
+					fmt.Errorf("dotgen timed out after %s", options.Timeout),
+				)
+				defer cancel()
+			}
+
+			return logic(ctx, options, logger)
 		},
 	}
 
 	root.Flags().StringVar(&options.Shell, "shell", shell, "The active shell")
-	root.Flags().StringSliceVarP(&options.Values, "values", "f", []string{}, "Additional YAML value files")
-	root.Flags().StringSliceVar(&options.EnvFiles, "env-file", []string{}, "Environment files to load before rendering")
 	root.Flags().
+		StringArrayVar(&options.Layers, "layer", []string{},
+			"Directory of configuration files laid over the previous ones (repeatable)")
+	root.Flags().
+		StringVar(&options.Interpreter, "interpreter", "", "Default interpreter for run commands (default: the shell)")
+	root.PersistentFlags().StringSliceVarP(&options.Values, "values", "f", []string{}, "Additional YAML value files")
+	root.Flags().StringSliceVar(&options.EnvFiles, "env-file", []string{}, "Environment files to load before rendering")
+	root.PersistentFlags().
 		StringSliceVar(&options.Set, "set", []string{}, "Set or override variables (key=value), strings only")
+	root.Flags().
+		StringSliceVar(&options.Tags, "tags", []string{}, "Select tagged commands and files (e.g. work,!gui)")
+	root.Flags().
+		StringVar(&options.OnDuplicate, "on-duplicate", OnDuplicateWarn,
+			"Policy for commands defined more than once (error|warn|last-wins)")
 	root.Flags().BoolVar(&options.Verbose, "verbose", false, "Show verbose output")
 	root.Flags().BoolVar(&options.Debug, "debug", false, "Show debug output")
 	root.Flags().BoolVarP(&options.Instrument, "instrument", "I", false, "Enable instrumentation for profiling")
 	root.Flags().
 		IntVarP(&options.Parallel, "parallel", "j", 1,
-			"Number of concurrent command exports (1 disables parallelism)")
+			"Number of concurrent command exports across all files (1 disables parallelism)")
+	root.Flags().
+		BoolVar(&options.Prune, "prune", false, "Remove exported files of commands that were deleted or are now excluded")
+	root.Flags().DurationVar(&options.Timeout, "timeout", 0, "Time limit for the whole invocation (0 disables the limit)")
+	root.Flags().BoolVar(&options.Refresh, "refresh", false, "Execute cached run commands again and update their cache")
 	root.Flags().
 		BoolVar(&options.Hash, "hash", false, "Compute a hash of all files that would be included and print it out")
 	root.Flags().
@@ -134,7 +206,36 @@ func (c CLI) Execute() error {
 
 	_ = root.Flags().MarkHidden("shell-completion")
 
+	root.AddCommand(cleanCommand(&options), stateCommand(&options))
+
 	root.Flags().SortFlags = false
 
-	return root.Execute() //nolint:wrapcheck 	// Error does not need additional wrapping.
+	ctx, cancel := interruptible()
+	defer cancel()
+
+	return root.ExecuteContext(ctx) //nolint:wrapcheck 	// Error does not need additional wrapping.
+}
+
+// interruptible returns a context that is cancelled when SIGINT or SIGTERM is received,
+// with the signal as the cause of the cancellation.
+// The signals are only caught once, so that a second one terminates the process immediately.
+func interruptible() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case sig := <-signals:
+			signal.Stop(signals)
+			cancel(fmt.Errorf("interrupted by %s", sig))
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel(nil)
+	}
 }
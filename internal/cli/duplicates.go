@@ -0,0 +1,162 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/idelchi/dotgen/internal/dotgen"
+)
+
+// Policies for commands defined more than once.
+const (
+	// OnDuplicateError fails when a name is defined more than once, unless one definition is marked as override.
+	OnDuplicateError = "error"
+	// OnDuplicateWarn keeps the last definition and prints a warning.
+	OnDuplicateWarn = "warn"
+	// OnDuplicateLastWins silently keeps the last definition.
+	OnDuplicateLastWins = "last-wins"
+)
+
+// DuplicatePolicies lists the supported policies for commands defined more than once.
+//
+//nolint:gochecknoglobals  // This is a constant list of supported policies.
+var DuplicatePolicies = []string{OnDuplicateError, OnDuplicateWarn, OnDuplicateLastWins}
+
+// definition locates a command within the units.
+type definition struct {
+	// unit is the index of the unit defining the command.
+	unit int
+	// command is the index of the command within the unit.
+	command int
+}
+
+// override records a command definition that was replaced by another definition of the same name.
+type override struct {
+	// name is the name of the command.
+	name string
+	// kind is the kind of the replaced definition.
+	kind string
+	// file is the file of the replaced definition.
+	file string
+	// byKind is the kind of the winning definition.
+	byKind string
+	// byFile is the file of the winning definition.
+	byFile string
+}
+
+// String returns a human-readable description of the override.
+func (o override) String() string {
+	return fmt.Sprintf("%s (%s) from %q, overridden by %s from %q", o.name, o.kind, o.file, o.byKind, o.byFile)
+}
+
+// resolveDuplicates detects alias and function names defined more than once across all units, and keeps a single
+// definition of each name.
+//
+// Definitions from higher layers replace those from lower layers. Among the definitions of the highest layer,
+// a definition marked with "override" wins over all others. Otherwise, the definition emitted last wins,
+// and the policy decides whether this is an error, a warning or silently accepted.
+// It returns the units without the replaced definitions, together with the list of replaced definitions.
+func resolveDuplicates(units []unit, policy string, logger Logger) ([]unit, []override, error) {
+	names := []string{}
+	definitions := map[string][]definition{}
+
+	for u, unit := range units {
+		for c, command := range unit.dotgen.Commands {
+			if command.Kind != dotgen.Alias && command.Kind != dotgen.Function {
+				continue
+			}
+
+			if _, ok := definitions[command.Name]; !ok {
+				names = append(names, command.Name)
+			}
+
+			definitions[command.Name] = append(definitions[command.Name], definition{unit: u, command: c})
+		}
+	}
+
+	dropped := map[definition]bool{}
+	overrides := []override{}
+	errs := []error{}
+
+	for _, name := range names {
+		defs := definitions[name]
+		if len(defs) < 2 { //nolint:mnd	// A single definition is not a duplicate.
+			continue
+		}
+
+		command := func(d definition) dotgen.Command { return units[d.unit].dotgen.Commands[d.command] }
+
+		// Definitions from the highest layer replace those of lower layers without further checks.
+		rank := func(d definition) int { return units[d.unit].rankOf(command(d)) }
+		top := slices.MaxFunc(defs, func(a, b definition) int { return rank(a) - rank(b) })
+		candidates := slices.DeleteFunc(slices.Clone(defs), func(d definition) bool { return rank(d) < rank(top) })
+
+		explicit := slices.DeleteFunc(slices.Clone(candidates), func(d definition) bool { return !command(d).Override })
+		locations := make([]string, 0, len(candidates))
+
+		for _, d := range candidates {
+			locations = append(locations, fmt.Sprintf("%s in %q", command(d).Kind, units[d.unit].file))
+		}
+
+		winner := candidates[len(candidates)-1]
+
+		switch {
+		case len(candidates) == 1:
+		case len(explicit) > 1:
+			errs = append(errs, fmt.Errorf("command %q is marked as override more than once: %s",
+				name, strings.Join(locations, ", ")))
+
+			continue
+		case len(explicit) == 1:
+			winner = explicit[0]
+		case policy == OnDuplicateError:
+			errs = append(errs, fmt.Errorf("command %q is defined more than once: %s "+
+				"(mark the winning definition with \"override: true\" or use --on-duplicate)",
+				name, strings.Join(locations, ", ")))
+
+			continue
+		case policy == OnDuplicateWarn:
+			logger.Warnf("command %q is defined more than once: %s; using the %s from %q",
+				name, strings.Join(locations, ", "), command(winner).Kind, units[winner.unit].file)
+		}
+
+		for _, d := range defs {
+			if d == winner {
+				continue
+			}
+
+			dropped[d] = true
+
+			overrides = append(overrides, override{
+				name:   name,
+				kind:   command(d).Kind,
+				file:   units[d.unit].file,
+				byKind: command(winner).Kind,
+				byFile: units[winner.unit].file,
+			})
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, nil, err
+	}
+
+	resolved := make([]unit, 0, len(units))
+
+	for u, unit := range units {
+		commands := make([]dotgen.Command, 0, len(unit.dotgen.Commands))
+
+		for c, command := range unit.dotgen.Commands {
+			if !dropped[definition{unit: u, command: c}] {
+				commands = append(commands, command)
+			}
+		}
+
+		unit.dotgen.Commands = commands
+		resolved = append(resolved, unit)
+	}
+
+	return resolved, overrides, nil
+}
@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"fmt"
+)
+
+// checkFiles reports an error if several files of the units are written to the same destination.
+func checkFiles(units []unit) error {
+	sources := map[string]string{}
+
+	for _, unit := range units {
+		for _, file := range unit.dotgen.Files {
+			path := absolute(file.Path())
+
+			if previous, ok := sources[path]; ok {
+				return fmt.Errorf("destination %q is rendered from both %q and %q", file.Path(), previous, file.Source)
+			}
+
+			sources[path] = file.Source
+		}
+	}
+
+	return nil
+}
+
+// writeFiles writes the rendered files of the units to their destinations.
+// Files whose content did not change are left untouched.
+func writeFiles(units []unit, logger Logger) error {
+	for _, unit := range units {
+		for _, file := range unit.dotgen.Files {
+			changed, err := file.Write()
+			if err != nil {
+				return err //nolint:wrapcheck // Error is already descriptive enough.
+			}
+
+			if changed {
+				logger.Printlnf("rendered %q to %q", file.Source, file.Path())
+			} else {
+				logger.Printlnf("%q is up to date", file.Path())
+			}
+		}
+	}
+
+	return nil
+}
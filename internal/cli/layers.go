@@ -0,0 +1,150 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/idelchi/dotgen/internal/dotgen"
+	"github.com/idelchi/dotgen/internal/variables"
+)
+
+// input represents a configuration file matched by the positional patterns or found in a layer.
+type input struct {
+	// file is the path of the configuration file.
+	file string
+	// rank is 0 for files matched by the positional patterns, and the 1-based position of the layer otherwise.
+	rank int
+	// layer is the directory of the layer, or empty for files matched by the positional patterns.
+	layer string
+	// path identifies the file across layers: its path relative to the layer directory.
+	path string
+}
+
+// expandInputs expands the positional patterns and the layer directories into configuration files.
+func expandInputs(options Options, logger Logger) ([]input, error) {
+	inputs := []input{}
+
+	files, err := expandFiles("config", options.Input, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		inputs = append(inputs, input{file: file, path: file})
+	}
+
+	for i, layer := range options.Layers {
+		info, err := os.Stat(layer)
+		if err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("layer %q is not a directory", layer)
+		}
+
+		files, err := expandFiles("layer", normalizePatterns([]string{layer + "/"}, DefaultPath), logger)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range files {
+			path, err := filepath.Rel(layer, file)
+			if err != nil {
+				return nil, fmt.Errorf("resolving %q in layer %q: %w", file, layer, err)
+			}
+
+			inputs = append(inputs, input{
+				file:  file,
+				rank:  i + 1,
+				layer: filepath.ToSlash(layer),
+				path:  filepath.ToSlash(path),
+			})
+		}
+	}
+
+	return inputs, nil
+}
+
+// groupInputs groups inputs sharing the same path across layers, in order of first appearance.
+// The first input of each group is the base file, and the following ones overlay it in layer order.
+func groupInputs(inputs []input) [][]input {
+	groups := [][]input{}
+	index := map[string]int{}
+
+	for _, in := range inputs {
+		key := fmt.Sprintf("%t:%s", in.rank > 0, in.path)
+
+		if i, ok := index[key]; ok {
+			groups[i] = append(groups[i], in)
+
+			continue
+		}
+
+		index[key] = len(groups)
+		groups = append(groups, []input{in})
+	}
+
+	return groups
+}
+
+// disabling represents a command listed in the "disable" header of a file.
+type disabling struct {
+	// name is the name of the command to remove.
+	name string
+	// rank is the rank of the layer declaring it.
+	rank int
+	// layer is the directory of the layer declaring it.
+	layer string
+}
+
+// applyDisables removes the disabled commands of each unit from all files of lower layers than the one declaring them.
+// Commands are compared by the layer they come from, so that files overlaid by higher layers are covered as well.
+func applyDisables(units []unit, logger Logger) []unit {
+	disables := []disabling{}
+
+	for _, unit := range units {
+		disables = append(disables, unit.disable...)
+	}
+
+	if len(disables) == 0 {
+		return units
+	}
+
+	for i, target := range units {
+		commands := []dotgen.Command{}
+
+		for _, command := range target.dotgen.Commands {
+			index := slices.IndexFunc(disables, func(d disabling) bool {
+				return d.name == command.Name && d.rank > target.rankOf(command)
+			})
+
+			if index >= 0 {
+				logger.Printlnf("disabling %q from %q by layer %q", command.Name, command.Source, disables[index].layer)
+
+				continue
+			}
+
+			commands = append(commands, command)
+		}
+
+		units[i].dotgen.Commands = commands
+	}
+
+	return units
+}
+
+// overlayHeader returns the header of the base file with the ordering fields of its overlays merged in.
+// The "order" constraints of all files apply, and the "priority" of a later layer replaces earlier ones.
+func overlayHeader(sources []*source) variables.Header {
+	header := sources[0].header
+
+	for _, src := range sources[1:] {
+		header.Order.After = slices.Concat(header.Order.After, src.header.Order.After)
+		header.Order.Before = slices.Concat(header.Order.Before, src.header.Order.Before)
+
+		if src.header.Priority != 0 {
+			header.Priority = src.header.Priority
+		}
+	}
+
+	return header
+}
@@ -0,0 +1,387 @@
+package cli
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+
+	"github.com/idelchi/dotgen/internal/dotgen"
+	"github.com/idelchi/dotgen/internal/format"
+	"github.com/idelchi/dotgen/internal/split"
+	"github.com/idelchi/dotgen/internal/variables"
+	"github.com/idelchi/dotgen/pkg/template"
+)
+
+// source represents a configuration file with its rendered header, its raw body,
+// and the files it includes.
+type source struct {
+	// file is the path of the configuration file.
+	file string
+	// header is the rendered and parsed header of the file.
+	header variables.Header
+	// body is the raw, not yet rendered body of the file.
+	body []byte
+	// templates are the template library files declared in the header.
+	templates []string
+	// includes are the files included through the header, in order.
+	includes []*source
+}
+
+// loader reads and renders configuration files with shared options and template definitions.
+type loader struct {
+	// options are the CLI options.
+	options Options
+	// logger is used for verbose output.
+	logger Logger
+	// library holds the template definitions shared by all files.
+	library *template.Library
+}
+
+// readSource reads a configuration file, renders and parses its header, and recursively reads its includes.
+// It returns nil if the file is empty or excluded by its header.
+// The stack holds the absolute paths of the including files and is used to detect include cycles.
+//
+//nolint:forbidigo // Function needs to print debug output to the console directly.
+func (l loader) readSource(file string, stack []string) (*source, error) {
+	absolute, err := filepath.Abs(filepath.Clean(file))
+	if err != nil {
+		return nil, fmt.Errorf("resolving %q: %w", file, err)
+	}
+
+	absolute = filepath.ToSlash(absolute)
+
+	if start := slices.Index(stack, absolute); start >= 0 {
+		chain := append(slices.Clone(stack[start:]), absolute)
+
+		return nil, fmt.Errorf("include cycle: %s", strings.Join(chain, " -> "))
+	}
+
+	data, err := os.ReadFile(filepath.Clean(file))
+	if err != nil {
+		return nil, fmt.Errorf("loading config: %w", err)
+	}
+
+	docs := split.YAML(data)
+
+	src := &source{file: file}
+
+	const maxDocs = 2
+
+	switch len(docs) {
+	case 0:
+		return nil, nil //nolint:nilnil	// An empty file has nothing to contribute.
+	case 1:
+		src.body = docs[0]
+
+		return src, nil
+	case maxDocs:
+		src.body = docs[1]
+	default:
+		return nil, fmt.Errorf("expected at most 2 documents in %q, got %d", file, len(docs))
+	}
+
+	vars, err := mergeVars(l.options, nil, file)
+	if err != nil {
+		return nil, err
+	}
+
+	facts, err := currentFacts(l.options, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	rendered, err := l.library.Apply(string(docs[0]), vars)
+	if err != nil {
+		return nil, err //nolint:wrapcheck // Error is already descriptive enough.
+	}
+
+	if l.options.Debug {
+		fmt.Println("header rendered as:")
+		fmt.Println("*******************")
+		fmt.Println(rendered)
+		fmt.Println("*******************")
+		fmt.Println()
+	}
+
+	src.header, err = variables.NewHeader([]byte(rendered))
+	if err != nil {
+		return nil, fmt.Errorf("parsing header in %q: %w", file, err)
+	}
+
+	if src.header.Exclude.IsExcluded() {
+		l.logger.Printlnf("    - skipping %q due to header exclusion", file)
+
+		return nil, nil //nolint:nilnil	// An excluded file has nothing to contribute.
+	}
+
+	if mismatch := src.header.Mismatch(facts); mismatch != "" {
+		l.logger.Printlnf("    - skipping %q due to header filters: %s", file, mismatch)
+
+		return nil, nil //nolint:nilnil	// A file scoped to other environments has nothing to contribute.
+	}
+
+	src.templates, err = expandRelative("template", src.header.Templates, filepath.Dir(file))
+	if err != nil {
+		return nil, fmt.Errorf("resolving templates in %q: %w", file, err)
+	}
+
+	includes, err := expandRelative("include", src.header.Include, filepath.Dir(file))
+	if err != nil {
+		return nil, fmt.Errorf("resolving includes in %q: %w", file, err)
+	}
+
+	for _, include := range includes {
+		l.logger.Printlnf("    - including %q", include)
+
+		if skipBySuffix(include, facts, l.logger) {
+			continue
+		}
+
+		included, err := l.readSource(include, append(slices.Clone(stack), absolute))
+		if err != nil {
+			return nil, err
+		}
+
+		if included != nil {
+			src.includes = append(src.includes, included)
+		}
+	}
+
+	return src, nil
+}
+
+// values returns the header values of the source merged over those of its includes.
+// Later includes override earlier ones, and the including file overrides all of its includes.
+func (s *source) values() variables.Variables {
+	values := variables.Variables{}
+
+	for _, include := range s.includes {
+		maps.Copy(values, include.values())
+	}
+
+	maps.Copy(values, s.header.Values)
+
+	return values
+}
+
+// flatten returns the source and all of its includes, included files first.
+// A file included more than once is only returned at its first occurrence.
+func (s *source) flatten() []*source {
+	sources := []*source{}
+	seen := map[string]bool{}
+
+	var walk func(*source)
+
+	walk = func(current *source) {
+		for _, include := range current.includes {
+			walk(include)
+		}
+
+		if !seen[current.file] {
+			seen[current.file] = true
+
+			sources = append(sources, current)
+		}
+	}
+
+	walk(s)
+
+	return sources
+}
+
+// templateFiles returns the template library files declared by the source and all of its includes.
+func (s *source) templateFiles() []string {
+	files := []string{}
+	for _, src := range s.flatten() {
+		files = append(files, src.templates...)
+	}
+
+	return files
+}
+
+// files returns the paths of the source and all of its includes, included files first.
+func (s *source) files() []string {
+	files := []string{}
+	for _, src := range s.flatten() {
+		files = append(files, src.file)
+	}
+
+	return files
+}
+
+// fingerprints returns the fingerprints of the declared dependencies of the source and its includes,
+// together with the fingerprints of the included files themselves.
+func (s *source) fingerprints() ([]string, error) {
+	records := []string{}
+
+	for _, src := range s.flatten() {
+		dependencies, err := src.header.Dependencies.Fingerprints(filepath.Dir(src.file))
+		if err != nil {
+			return nil, fmt.Errorf("fingerprinting dependencies in %q: %w", src.file, err)
+		}
+
+		records = append(records, dependencies...)
+
+		for _, file := range src.templates {
+			digest, err := format.Fingerprint(file)
+			if err != nil {
+				return nil, fmt.Errorf("fingerprinting template %q: %w", file, err)
+			}
+
+			records = append(records, fmt.Sprintf("template %q: sha256=%s", file, digest))
+		}
+
+		if src == s {
+			continue
+		}
+
+		digest, err := format.Fingerprint(src.file)
+		if err != nil {
+			return nil, fmt.Errorf("fingerprinting include %q: %w", src.file, err)
+		}
+
+		records = append(records, fmt.Sprintf("include %q: sha256=%s", src.file, digest))
+	}
+
+	slices.Sort(records)
+
+	return slices.Compact(records), nil
+}
+
+// render renders the bodies of the source and its includes with the given header values and
+// merges them into a single configuration. Each body is rendered with its own file context, and with the
+// shared template library extended by the templates declared in the headers.
+// Commands inherit the tags of the header of their file and of the including file.
+// Entries of an including file override same-named env and vars entries of its includes.
+//
+//nolint:forbidigo // Function needs to print debug output to the console directly.
+func (l loader) render(s *source, values variables.Variables) (dotgen.Dotgen, error) {
+	var merged dotgen.Dotgen
+
+	library, err := l.library.With(s.templateFiles()...)
+	if err != nil {
+		return merged, err //nolint:wrapcheck // Error is already descriptive enough.
+	}
+
+	for _, src := range s.flatten() {
+		vars, err := mergeVars(l.options, values, src.file)
+		if err != nil {
+			return merged, err
+		}
+
+		vars.AppendCwd()
+
+		rendered, err := library.Apply(string(src.body), vars)
+		if err != nil {
+			return merged, err //nolint:wrapcheck // Error is already descriptive enough.
+		}
+
+		if l.options.Debug {
+			fmt.Println("body rendered as:")
+			fmt.Println("*******************")
+			fmt.Println(rendered)
+			fmt.Println("*******************")
+
+			continue
+		}
+
+		dotgen, err := dotgen.New([]byte(rendered))
+		if err != nil {
+			return merged, fmt.Errorf("in %q: %w", src.file, err)
+		}
+
+		if err := dotgen.Validate(); err != nil {
+			return merged, fmt.Errorf("in %q: %w", src.file, err)
+		}
+
+		for i := range dotgen.Commands {
+			dotgen.Commands[i].Source = src.file
+		}
+
+		dotgen = dotgen.Tagged(slices.Concat(s.header.Tags, src.header.Tags))
+
+		facts, err := currentFacts(l.options, vars)
+		if err != nil {
+			return merged, err
+		}
+
+		// Only the templates of applicable files are read, as the others may not exist on this machine.
+		// Hashing and dry runs fingerprint the templates themselves, so they are not rendered.
+		files := dotgen.Files[:0]
+
+		for _, file := range dotgen.Files {
+			if file.IsExcluded(facts) {
+				continue
+			}
+
+			if err := file.Resolve(filepath.Dir(src.file)); err != nil {
+				return merged, fmt.Errorf("in %q: %w", src.file, err)
+			}
+
+			if !l.options.Hash && !l.options.Dry {
+				if err := renderFile(&file, library, vars); err != nil {
+					return merged, fmt.Errorf("in %q: %w", src.file, err)
+				}
+			}
+
+			files = append(files, file)
+		}
+
+		dotgen.Files = files
+
+		merged = merged.Merge(dotgen)
+	}
+
+	return merged, nil
+}
+
+// renderFile renders the template of the file.
+func renderFile(file *dotgen.File, library *template.Library, vars variables.Variables) error {
+	data, err := os.ReadFile(filepath.Clean(file.Source))
+	if err != nil {
+		return fmt.Errorf("reading file template: %w", err)
+	}
+
+	file.Content, err = library.Render(string(data), vars)
+	if err != nil {
+		return fmt.Errorf("rendering file template %q: %w", file.Source, err)
+	}
+
+	return nil
+}
+
+// expandRelative expands patterns relative to the given directory into file paths.
+// Patterns without glob characters must match an existing file.
+func expandRelative(kind string, patterns []string, dir string) ([]string, error) {
+	files := []string{}
+
+	for _, pattern := range patterns {
+		pattern = filepath.ToSlash(pattern)
+
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.ToSlash(filepath.Join(dir, pattern))
+		}
+
+		base, glob := doublestar.SplitPattern(pattern)
+
+		matches, err := doublestar.Glob(os.DirFS(base), glob, doublestar.WithFilesOnly())
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s pattern %q: %w", kind, pattern, err)
+		}
+
+		if len(matches) == 0 && !strings.ContainsAny(glob, "*?[{") {
+			return nil, fmt.Errorf("%s file %q does not exist", kind, pattern)
+		}
+
+		for _, match := range matches {
+			files = append(files, filepath.ToSlash(filepath.Join(base, match)))
+		}
+	}
+
+	return files, nil
+}
@@ -17,3 +17,8 @@ func (l Logger) Printlnf(format string, args ...any) {
 		fmt.Fprintf(os.Stderr, "[dotgen]: "+format+"\n", args...)
 	}
 }
+
+// Warnf prints a formatted warning to stderr, regardless of Verbose.
+func (l Logger) Warnf(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "[dotgen]: warning: "+format+"\n", args...)
+}
@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"maps"
@@ -12,7 +13,8 @@ import (
 
 	"github.com/idelchi/dotgen/internal/dotgen"
 	"github.com/idelchi/dotgen/internal/format"
-	"github.com/idelchi/dotgen/internal/split"
+	"github.com/idelchi/dotgen/internal/ordered"
+	"github.com/idelchi/dotgen/internal/state"
 	"github.com/idelchi/dotgen/internal/variables"
 	"github.com/idelchi/dotgen/pkg/template"
 )
@@ -21,11 +23,11 @@ import (
 //
 // It processes the provided options, loads and merges variables, reads and
 // renders dotgen configuration files, validates them, filters commands based
-// on the current OS and shell, and exports the final configuration to the
-// console.
+// on the current OS and shell, orders files and commands by their constraints,
+// and exports the final configuration to the console.
 //
 //nolint:gocognit,funlen,forbidigo,cyclop,gocyclo,maintidx,nestif // TODO(Idelchi): Refactor.
-func logic(options Options, logger Logger) error {
+func logic(ctx context.Context, options Options, logger Logger) error {
 	if options.Debug {
 		fmt.Println("default variables:")
 		fmt.Println("*******************")
@@ -34,10 +36,43 @@ func logic(options Options, logger Logger) error {
 		fmt.Println()
 	}
 
-	if len(options.Input) == 0 {
-		return errors.New("no input file provided, specify using --input/-i")
+	if len(options.Input) == 0 && len(options.Layers) == 0 {
+		return errors.New("no input file provided, specify using patterns or --layer")
 	}
 
+	var err error
+
+	options.Values, err = activeValues(options, logger)
+	if err != nil {
+		return err
+	}
+
+	inputs, err := expandInputs(options, logger)
+	if err != nil {
+		return err
+	}
+
+	if len(inputs) == 0 {
+		return fmt.Errorf("no files matched the provided patterns: %v or layers: %v", options.Input, options.Layers)
+	}
+
+	files := make([]string, 0, len(inputs))
+	for _, input := range inputs {
+		files = append(files, input.file)
+	}
+
+	templates, err := discoverTemplates(files)
+	if err != nil {
+		return err
+	}
+
+	library, err := template.NewLibrary(templates...)
+	if err != nil {
+		return err //nolint:wrapcheck // Error is already descriptive enough.
+	}
+
+	loader := loader{options: options, logger: logger, library: library}
+
 	envFiles, err := expandFiles("env file", options.EnvFiles, logger)
 	if err != nil {
 		return err
@@ -47,7 +82,7 @@ func logic(options Options, logger Logger) error {
 		return fmt.Errorf("no env files matched the provided patterns: %v", options.EnvFiles)
 	}
 
-	envFromFiles := dotgen.Env{}
+	envFromFiles := map[string]string{}
 	activeEnvFiles := []string{}
 
 	if len(envFiles) > 0 {
@@ -56,9 +91,9 @@ func logic(options Options, logger Logger) error {
 			return err
 		}
 
-		currentOS, ok := vars["OS"].(string)
-		if !ok {
-			return fmt.Errorf("expected string for OS, got %T", vars["OS"])
+		facts, err := currentFacts(options, vars)
+		if err != nil {
+			return err
 		}
 
 		logger.Printlnf("processing %d env file(s)", len(envFiles))
@@ -67,14 +102,7 @@ func logic(options Options, logger Logger) error {
 		for _, file := range envFiles {
 			logger.Printlnf("  - %q", file)
 
-			platformSuffix := getPlatformSuffixFromFileName(file)
-			if !platformSuffixMatches(platformSuffix, currentOS) {
-				logger.Printlnf(
-					"    - skipping due to file suffix platform exclusion: file is for %q, current platform suffixes are %v",
-					platformSuffix,
-					activePlatformSuffixes(currentOS),
-				)
-
+			if skipBySuffix(file, facts, logger) {
 				continue
 			}
 
@@ -93,7 +121,7 @@ func logic(options Options, logger Logger) error {
 					return fmt.Errorf("loading env file: %w", err)
 				}
 
-				rendered, err := template.Apply(string(data), vars)
+				rendered, err := library.Apply(string(data), vars)
 				if err != nil {
 					return err //nolint:wrapcheck // Error is already descriptive enough.
 				}
@@ -114,27 +142,25 @@ func logic(options Options, logger Logger) error {
 		}
 	}
 
-	files, err := expandFiles("config", options.Input, logger)
-	if err != nil {
-		return err
-	}
-
-	if len(files) == 0 {
-		return fmt.Errorf("no files matched the provided patterns: %v", options.Input)
-	}
-
 	logger.Printlnf("processing %d file(s)", len(files))
 
 	logger.Printlnf(" - processing:")
 
 	included := make(map[string]string)
+	units := []unit{}
+
+	for _, file := range library.Files() {
+		included[file] = "template library"
+	}
+
+	env := dotgen.Env(ordered.FromMap(envFromFiles))
 
 	for _, file := range activeEnvFiles {
-		included[file] = envFromFiles.Export()
+		included[file] = env.Export()
 	}
 
-	if len(envFromFiles) > 0 && !options.Dry && !options.Hash && !options.Debug {
-		export, err := dotgen.Dotgen{Env: envFromFiles}.Export(options.Shell, "env files", false, 1)
+	if len(env) > 0 && !options.Dry && !options.Hash && !options.Debug {
+		export, err := dotgen.Dotgen{Env: env}.Export(ctx, "env files", dotgen.Options{Shell: options.Shell})
 		if err != nil {
 			return err //nolint:wrapcheck // Error is already descriptive enough.
 		}
@@ -151,100 +177,96 @@ func logic(options Options, logger Logger) error {
 		fmt.Println()
 	}
 
-	for _, file := range files {
-		logger.Printlnf("  - %q", file)
+	for _, group := range groupInputs(inputs) {
+		sources := []*source{}
+		layers := []input{}
 
-		dependencyRecords := []string{}
+		for _, input := range group {
+			if input.layer == "" {
+				logger.Printlnf("  - %q", input.file)
+			} else {
+				logger.Printlnf("  - %q (layer %q)", input.file, input.layer)
+			}
 
-		vars, err := mergeVars(options, nil, file)
-		if err != nil {
-			return err
-		}
+			vars, err := mergeVars(options, nil, input.file)
+			if err != nil {
+				return err
+			}
 
-		currentOS, ok := vars["OS"].(string)
-		if !ok {
-			return fmt.Errorf("expected string for OS, got %T", vars["OS"])
-		}
+			facts, err := currentFacts(options, vars)
+			if err != nil {
+				return err
+			}
 
-		platformSuffix := getPlatformSuffixFromFileName(file)
-		if !platformSuffixMatches(platformSuffix, currentOS) {
-			logger.Printlnf(
-				"    - skipping due to file suffix platform exclusion: file is for %q, current platform suffixes are %v",
-				platformSuffix,
-				activePlatformSuffixes(currentOS),
-			)
+			if skipBySuffix(input.file, facts, logger) {
+				continue
+			}
 
-			continue
-		}
+			src, err := loader.readSource(input.file, nil)
+			if err != nil {
+				return err
+			}
 
-		data, err := os.ReadFile(filepath.Clean(file))
-		if err != nil {
-			return fmt.Errorf("loading config: %w", err)
+			if src == nil {
+				continue
+			}
+
+			sources = append(sources, src)
+			layers = append(layers, input)
 		}
 
-		docs := split.YAML(data)
+		if len(sources) == 0 {
+			continue
+		}
 
-		var doc []byte
+		file := sources[0].file
 
-		const maxDocs = 2
+		// Header values of overlays from later layers override those of the base file.
+		values := variables.Variables{}
+		for _, src := range sources {
+			maps.Copy(values, src.values())
+		}
 
-		switch len(docs) {
-		case 0:
-			continue
-		case 1:
-			doc = docs[0]
-		case maxDocs:
-			rendered, err := template.Apply(string(docs[0]), vars)
-			if err != nil {
-				return err //nolint:wrapcheck // Error is already descriptive enough.
-			}
+		vars, err := mergeVars(options, values, file)
+		if err != nil {
+			return err
+		}
 
-			if options.Debug {
-				fmt.Println("header rendered as:")
-				fmt.Println("*******************")
-				fmt.Println(rendered)
-				fmt.Println("*******************")
-				fmt.Println()
-			}
+		dependencyRecords := []string{}
+		sourceFiles := []string{}
+		disable := []disabling{}
+		ranks := map[string]int{}
 
-			header, err := variables.NewHeader([]byte(rendered))
+		for i, src := range sources {
+			records, err := src.fingerprints()
 			if err != nil {
-				return fmt.Errorf("parsing header in %q: %w", file, err)
+				return err
 			}
 
-			if header.Exclude.IsExcluded() {
-				logger.Printlnf("    - skipping due to header exclusion")
+			dependencyRecords = append(dependencyRecords, records...)
+			sourceFiles = append(sourceFiles, src.files()...)
 
-				continue
+			for _, name := range src.header.Disable {
+				disable = append(disable, disabling{name: name, rank: layers[i].rank, layer: layers[i].layer})
 			}
 
-			vars, err = mergeVars(options, header.Values, file)
-			if err != nil {
-				return err
+			for _, file := range src.files() {
+				ranks[file] = layers[i].rank
 			}
+		}
 
-			dependencyRecords, err = header.Dependencies.Fingerprints(filepath.Dir(file))
-			if err != nil {
-				return fmt.Errorf("fingerprinting dependencies in %q: %w", file, err)
-			}
+		if options.Debug {
+			fmt.Println("merged variables:")
+			fmt.Println("*******************")
+			fmt.Println(format.Map(vars, "%s=%q"))
+			fmt.Println("*******************")
 
-			if options.Debug {
-				fmt.Println("merged variables:")
+			if len(dependencyRecords) > 0 {
+				fmt.Println("dependency fingerprints:")
 				fmt.Println("*******************")
-				fmt.Println(format.Map(vars, "%s=%q"))
+				fmt.Println(strings.Join(dependencyRecords, "\n"))
 				fmt.Println("*******************")
-
-				if len(dependencyRecords) > 0 {
-					fmt.Println("dependency fingerprints:")
-					fmt.Println("*******************")
-					fmt.Println(strings.Join(dependencyRecords, "\n"))
-					fmt.Println("*******************")
-				}
 			}
-
-			doc = docs[1]
-		default:
-			return fmt.Errorf("expected at most 2 documents in %q, got %d", file, len(docs))
 		}
 
 		hashState := vars.Export()
@@ -253,50 +275,62 @@ func logic(options Options, logger Logger) error {
 			hashState += "\n[dependencies]\n" + strings.Join(dependencyRecords, "\n")
 		}
 
-		included[file] = hashState
+		if top := layers[len(layers)-1]; top.layer != "" {
+			hashState += "\n[layers]"
 
-		if options.Dry || options.Hash {
-			continue
+			for _, layer := range layers {
+				hashState += fmt.Sprintf("\n%d %q %q", layer.rank, layer.layer, layer.file)
+			}
 		}
 
-		vars.AppendCwd()
+		for _, src := range sources {
+			included[src.file] = hashState
+		}
 
-		rendered, err := template.Apply(string(doc), vars)
+		dotgen, err := loader.render(sources[0], values)
 		if err != nil {
-			return err //nolint:wrapcheck // Error is already descriptive enough.
+			return err
 		}
 
-		if options.Debug {
-			fmt.Println("body rendered as:")
-			fmt.Println("*******************")
-			fmt.Println(rendered)
-			fmt.Println("*******************")
+		for _, src := range sources[1:] {
+			overlay, err := loader.render(src, values)
+			if err != nil {
+				return err
+			}
 
-			continue
+			dotgen = dotgen.Without(src.header.Disable).Overlay(overlay)
 		}
 
-		dotgen, err := dotgen.New([]byte(rendered))
-		if err != nil {
-			return err //nolint:wrapcheck // Error is already descriptive enough.
+		if options.Debug {
+			continue
 		}
 
-		if err := dotgen.Validate(); err != nil {
-			return err //nolint:wrapcheck // Error is already descriptive enough.
+		facts, err := currentFacts(options, vars)
+		if err != nil {
+			return err
 		}
 
-		dotgen = dotgen.Filtered(activePlatformSuffixes(currentOS), options.Shell)
+		dotgen = dotgen.Filtered(facts)
 
-		export, err := dotgen.Export(options.Shell, file, options.Instrument, options.Parallel)
-		if err != nil {
-			return err //nolint:wrapcheck // Error is already descriptive enough.
+		// File templates are rendered with the variables of the unit, and count towards the hash like its sources.
+		for _, file := range dotgen.Files {
+			included[file.Source] += fmt.Sprintf("%s\n[file]\n%q %q", hashState, file.Destination, file.Mode)
 		}
 
-		if options.Verbose {
-			printVerboseBlock(formatSources([]string{file}), "Template variables", format.Map(vars, "# %s=%q"))
+		if options.Dry || options.Hash {
+			continue
 		}
 
-		fmt.Println(export)
-		fmt.Println()
+		units = append(units, unit{
+			file:    file,
+			sources: sourceFiles,
+			header:  overlayHeader(sources),
+			vars:    vars,
+			dotgen:  dotgen,
+			ranks:   ranks,
+			layer:   layers[len(layers)-1].layer,
+			disable: disable,
+		})
 	}
 
 	if options.Dry {
@@ -318,5 +352,77 @@ func logic(options Options, logger Logger) error {
 		return nil
 	}
 
+	// Debug mode only shows the rendered templates, so nothing is exported and exported files are left untouched.
+	if options.Debug {
+		return nil
+	}
+
+	units = applyDisables(units, logger)
+
+	units, err = sortUnits(units)
+	if err != nil {
+		return err
+	}
+
+	units, overrides, err := resolveDuplicates(units, options.OnDuplicate, logger)
+	if err != nil {
+		return err
+	}
+
+	if options.Verbose && len(overrides) > 0 {
+		printOverrides(overrides)
+	}
+
+	// Conflicting destinations are reported before anything is exported, so that no file is written.
+	if err := checkFiles(units); err != nil {
+		return err
+	}
+
+	path, err := statePath(options)
+	if err != nil {
+		return err
+	}
+
+	// The state stays locked while exporting, so that concurrent invocations do not run the same commands once each.
+	stamps, err := state.Load(path)
+	if err != nil {
+		return err //nolint:wrapcheck // Error is already descriptive enough.
+	}
+
+	jobs := make([]dotgen.Job, 0, len(units))
+
+	for _, unit := range units {
+		jobs = append(jobs, dotgen.Job{File: unit.file, Dotgen: unit.dotgen, Options: exportOptions(options, unit.vars, stamps, logger)})
+	}
+
+	exports, err := dotgen.ExportAll(ctx, jobs, options.Parallel)
+	if err := errors.Join(err, stamps.Save(), stamps.Close()); err != nil {
+		return err //nolint:wrapcheck // Error is already descriptive enough.
+	}
+
+	if err := writeFiles(units, logger); err != nil {
+		return err
+	}
+
+	if err := recordExports(units, files, options, logger); err != nil {
+		return err
+	}
+
+	for i, unit := range units {
+		export := exports[i]
+
+		if options.Verbose {
+			sources := formatSources(unit.sources)
+			if unit.layer != "" {
+				sources += fmt.Sprintf(" (layer %q)", unit.layer)
+			}
+
+			printVerboseBlock(sources, "Template variables", format.Map(unit.vars, "# %s=%q"))
+		}
+
+		fmt.Println(export)
+		fmt.Println()
+	}
+
 	return nil
 }
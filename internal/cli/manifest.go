@@ -0,0 +1,172 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/idelchi/dotgen/internal/manifest"
+)
+
+// dataDir returns the directory dotgen keeps its manifest and state in, below CACHE_DIR.
+// CACHE_DIR is taken from the defaults, --values and --set, but not from the headers of configuration files,
+// as the manifest and state are shared by all of them.
+func dataDir(options Options) (string, error) {
+	vars, err := mergeVars(options, nil, "")
+	if err != nil {
+		return "", err
+	}
+
+	dir, ok := vars["CACHE_DIR"].(string)
+	if !ok {
+		return "", fmt.Errorf("expected string for CACHE_DIR, got %T", vars["CACHE_DIR"])
+	}
+
+	return filepath.Join(dir, "dotgen"), nil
+}
+
+// manifestPath returns the path of the manifest of exported files.
+func manifestPath(options Options) (string, error) {
+	dir, err := dataDir(options)
+
+	return filepath.Join(dir, "manifest.json"), err
+}
+
+// profile identifies the options that select which files are exported from the configuration files,
+// so that generations with different options do not mark each other's exports as stale.
+func profile(options Options) string {
+	layers := make([]string, 0, len(options.Layers))
+
+	for _, layer := range options.Layers {
+		layers = append(layers, absolute(layer))
+	}
+
+	return fmt.Sprintf(
+		"shell=%s tags=%s layers=%s",
+		options.Shell,
+		strings.Join(slices.Sorted(slices.Values(options.Tags)), ","),
+		strings.Join(layers, ","),
+	)
+}
+
+// recordExports records the files exported by the units in the manifest.
+// Previously exported files of the processed configuration files that the same options no longer export
+// become stale, and are removed if prune is set.
+func recordExports(units []unit, processed []string, options Options, logger Logger) (err error) {
+	path, err := manifestPath(options)
+	if err != nil {
+		return err
+	}
+
+	exports, err := manifest.Load(path)
+	if err != nil {
+		return err //nolint:wrapcheck // Error is already descriptive enough.
+	}
+
+	defer func() { err = errors.Join(err, exports.Close()) }()
+
+	sources := make([]string, 0, len(processed))
+
+	for _, file := range processed {
+		sources = append(sources, absolute(file))
+	}
+
+	exported := []manifest.Entry{}
+
+	for _, unit := range units {
+		for _, command := range unit.dotgen.Commands {
+			if path := command.ExportPath(); path != "" {
+				exported = append(exported, manifest.Entry{
+					Path:    absolute(path),
+					Command: command.Name,
+					Source:  absolute(unit.file),
+				})
+			}
+		}
+
+		for _, file := range unit.dotgen.Files {
+			exported = append(exported, manifest.Entry{
+				Path:    absolute(file.Path()),
+				Command: "files",
+				Source:  absolute(unit.file),
+			})
+		}
+	}
+
+	exports.Update(profile(options), sources, exported)
+
+	stale := exports.Stale()
+
+	switch {
+	case options.Prune:
+		if err := exports.Remove(stale); err != nil {
+			return err //nolint:wrapcheck // Error is already descriptive enough.
+		}
+
+		for _, entry := range stale {
+			logger.Printlnf("pruned %q, exported by %q in %q", entry.Path, entry.Command, entry.Source)
+		}
+	case len(stale) > 0:
+		logger.Printlnf("%d stale exported file(s), remove with --prune or `dotgen clean`", len(stale))
+	}
+
+	return exports.Save() //nolint:wrapcheck // Error is already descriptive enough.
+}
+
+// cleanCommand returns the command removing exported files recorded in the manifest.
+func cleanCommand(options *Options) *cobra.Command {
+	var all bool
+
+	cmd := &cobra.Command{
+		Use:   "clean",
+		Short: "Remove exported files that are no longer generated",
+		Long: "Remove files written by export_to or files: whose entries were deleted or are now excluded, " +
+			"as recorded by the last generation. With --all, remove all exported files.",
+		Args: cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) (err error) {
+			path, err := manifestPath(*options)
+			if err != nil {
+				return err
+			}
+
+			exports, err := manifest.Load(path)
+			if err != nil {
+				return err //nolint:wrapcheck // Error is already descriptive enough.
+			}
+
+			defer func() { err = errors.Join(err, exports.Close()) }()
+
+			remove := exports.Stale()
+			if all {
+				remove = exports.Entries
+			}
+
+			if err := exports.Remove(remove); err != nil {
+				return err //nolint:wrapcheck // Error is already descriptive enough.
+			}
+
+			for _, entry := range remove {
+				fmt.Println(entry.Path) //nolint:forbidigo // Removed files are the output of the command.
+			}
+
+			return exports.Save() //nolint:wrapcheck // Error is already descriptive enough.
+		},
+	}
+
+	cmd.Flags().BoolVar(&all, "all", false, "Remove all exported files, not only stale ones")
+
+	return cmd
+}
+
+// absolute returns the absolute form of the path, or the path itself if it cannot be resolved.
+func absolute(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+
+	return path
+}
@@ -0,0 +1,113 @@
+package cli
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/idelchi/dotgen/internal/dotgen"
+	"github.com/idelchi/dotgen/internal/order"
+	"github.com/idelchi/dotgen/internal/suffix"
+	"github.com/idelchi/dotgen/internal/variables"
+)
+
+// unit represents a rendered and filtered configuration file, ready to be ordered and exported.
+type unit struct {
+	// file is the path of the configuration file.
+	file string
+	// sources are the paths of the file and all files it includes, included files first.
+	sources []string
+	// header is the parsed header of the file.
+	header variables.Header
+	// vars are the merged template variables used to render the file.
+	vars variables.Variables
+	// dotgen is the rendered and filtered configuration.
+	dotgen dotgen.Dotgen
+	// ranks maps the sources to the rank of the layer they belong to, 0 for files matched by the positional patterns.
+	ranks map[string]int
+	// layer is the directory of the highest layer contributing to the file.
+	layer string
+	// disable contains the commands to remove from files of lower layers.
+	disable []disabling
+}
+
+// rankOf returns the rank of the layer the command comes from.
+func (u unit) rankOf(command dotgen.Command) int {
+	return u.ranks[command.Source]
+}
+
+// sortUnits orders the files topologically and then the commands within each file.
+//
+// Files are referred to by their base name without extension and filename suffix.
+// They are ordered by the "order" constraints and "priority" of their headers,
+// and by the "after" and "before" constraints of commands that name commands in other files.
+// Files without constraints between them keep their priority and then glob order.
+func sortUnits(units []unit) ([]unit, error) {
+	var graph order.Graph
+
+	files := map[string][]int{}
+	commands := map[string][]int{}
+
+	for i, unit := range units {
+		graph.Add(unit.file, unit.header.Priority)
+
+		name := suffix.Name(unit.file)
+		files[name] = append(files[name], i)
+
+		for _, command := range unit.dotgen.Names() {
+			if !slices.Contains(commands[command], i) {
+				commands[command] = append(commands[command], i)
+			}
+		}
+	}
+
+	for i, unit := range units {
+		graph.Link(i, unit.header.Order, func(name string) []int { return files[name] })
+
+		for _, command := range unit.dotgen.Commands {
+			link(&graph, i, unit.file, command, commands)
+		}
+	}
+
+	indices, err := graph.Sort()
+	if err != nil {
+		return nil, fmt.Errorf("ordering files: %w", err)
+	}
+
+	sorted := make([]unit, 0, len(units))
+
+	for _, i := range indices {
+		unit := units[i]
+
+		unit.dotgen, err = unit.dotgen.Sorted()
+		if err != nil {
+			return nil, fmt.Errorf("in %q: %w", unit.file, err)
+		}
+
+		sorted = append(sorted, unit)
+	}
+
+	return sorted, nil
+}
+
+// link adds the edges between files described by the "after" and "before" constraints of a command of the file
+// at index, naming the commands involved as the reason.
+// Files are ordered as a whole, so constraints between the commands of two files must not point both ways.
+func link(graph *order.Graph, index int, file string, command dotgen.Command, commands map[string][]int) {
+	for _, name := range command.Constraints.After {
+		for _, other := range commands[name] {
+			if other != index {
+				graph.Edge(other, index)
+				graph.Explain(other, index, fmt.Sprintf("%q in %q comes after %q", command.Name, file, name))
+			}
+		}
+	}
+
+	for _, name := range command.Constraints.Before {
+		for _, other := range commands[name] {
+			if other != index {
+				graph.Edge(index, other)
+				graph.Explain(index, other, fmt.Sprintf("%q in %q comes before %q", command.Name, file, name))
+			}
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+
+	"github.com/spf13/cobra"
+
+	"github.com/idelchi/dotgen/internal/state"
+)
+
+// statePath returns the path of the completion stamps of commands that run only once.
+func statePath(options Options) (string, error) {
+	dir, err := dataDir(options)
+
+	return filepath.Join(dir, "state.json"), err
+}
+
+// stateCommand returns the command managing the completion stamps of commands that run only once.
+func stateCommand(options *Options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "state",
+		Short: "Manage the completion stamps of commands that run once",
+	}
+
+	reset := &cobra.Command{
+		Use:   "reset <name>...",
+		Short: "Forget that commands ran, so that they run again on the next generation",
+		Long:  "Forget the completion stamps of commands with `once`, by their once key, which defaults to their name.",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(_ *cobra.Command, args []string) (err error) {
+			path, err := statePath(*options)
+			if err != nil {
+				return err
+			}
+
+			stamps, err := state.Load(path)
+			if err != nil {
+				return err //nolint:wrapcheck // Error is already descriptive enough.
+			}
+
+			defer func() { err = errors.Join(err, stamps.Close()) }()
+
+			logger := Logger{}
+
+			removed := stamps.Reset(args...)
+
+			for _, key := range args {
+				if !slices.Contains(removed, key) {
+					logger.Warnf("no completion stamp for %q", key)
+				}
+			}
+
+			for _, key := range removed {
+				fmt.Println(key) //nolint:forbidigo // Reset keys are the output of the command.
+			}
+
+			return stamps.Save() //nolint:wrapcheck // Error is already descriptive enough.
+		},
+	}
+
+	cmd.AddCommand(reset)
+
+	return cmd
+}
@@ -6,12 +6,17 @@ import (
 	"maps"
 	"os"
 	"path/filepath"
+	"runtime"
 	"slices"
 	"strings"
 	"time"
 
 	"github.com/bmatcuk/doublestar/v4"
 
+	"github.com/idelchi/dotgen/internal/dotgen"
+	"github.com/idelchi/dotgen/internal/filter"
+	"github.com/idelchi/dotgen/internal/state"
+	"github.com/idelchi/dotgen/internal/suffix"
 	"github.com/idelchi/dotgen/internal/variables"
 )
 
@@ -28,6 +33,8 @@ func mergeVars(options Options, headers variables.Variables, file string) (varia
 	// Load default variables first
 	vars := variables.Defaults(options.Shell, file)
 
+	vars["TAGS"] = options.Selection.Include
+
 	if headers != nil {
 		maps.Copy(vars, headers)
 	}
@@ -49,6 +56,46 @@ func mergeVars(options Options, headers variables.Variables, file string) (varia
 	return vars, nil
 }
 
+// currentFacts returns the facts about the current environment that command and header filters are evaluated
+// against, taken from the given variables.
+func currentFacts(options Options, vars variables.Variables) (filter.Facts, error) {
+	values := map[string]string{}
+
+	for _, key := range []string{"OS", "HOSTNAME", "USER", "ARCHITECTURE", "DISTRO", "DISTRO_FAMILY"} {
+		if vars[key] == nil {
+			continue
+		}
+
+		value, ok := vars[key].(string)
+		if !ok {
+			return filter.Facts{}, fmt.Errorf("expected string for %s, got %T", key, vars[key])
+		}
+
+		values[key] = value
+	}
+
+	facts := filter.Facts{
+		Platforms: activePlatformSuffixes(values["OS"]),
+		Shell:     options.Shell,
+		Host:      values["HOSTNAME"],
+		User:      values["USER"],
+		Arch:      []string{runtime.GOARCH},
+		Selection: options.Selection,
+	}
+
+	if arch := values["ARCHITECTURE"]; arch != "" && arch != runtime.GOARCH {
+		facts.Arch = append(facts.Arch, arch)
+	}
+
+	for _, distro := range []string{values["DISTRO"], values["DISTRO_FAMILY"]} {
+		if distro != "" && !slices.Contains(facts.Distro, distro) {
+			facts.Distro = append(facts.Distro, distro)
+		}
+	}
+
+	return facts, nil
+}
+
 // normalizePatterns expands directory-like patterns to use the given default path.
 // It returns forward-slash-normalized patterns.
 func normalizePatterns(patterns []string, defaultPath string) []string {
@@ -102,6 +149,32 @@ func expandFiles(kind string, patterns []string, logger Logger) ([]string, error
 	return files, nil
 }
 
+// discoverTemplates returns the template library files (`*.tpl`) located next to the given configuration files.
+func discoverTemplates(files []string) ([]string, error) {
+	templates := []string{}
+	dirs := map[string]bool{}
+
+	for _, file := range files {
+		dir := filepath.ToSlash(filepath.Dir(file))
+		if dirs[dir] {
+			continue
+		}
+
+		dirs[dir] = true
+
+		matches, err := doublestar.Glob(os.DirFS(dir), "*.tpl", doublestar.WithFilesOnly())
+		if err != nil {
+			return nil, fmt.Errorf("discovering templates in %q: %w", dir, err)
+		}
+
+		for _, match := range matches {
+			templates = append(templates, filepath.ToSlash(filepath.Join(dir, match)))
+		}
+	}
+
+	return templates, nil
+}
+
 // formatSources formats file paths for a generated source comment.
 func formatSources(files []string) string {
 	sources := make([]string, 0, len(files))
@@ -132,41 +205,60 @@ func printVerboseBlock(source, label, values string) {
 	fmt.Println()
 }
 
-// getPlatformSuffixFromFileName checks if the file name ends with _<platform> before the extension.
-// It returns the platform suffix if found, otherwise an empty string.
-func getPlatformSuffixFromFileName(file string) string {
-	base := filepath.Base(file)
-	ext := filepath.Ext(base)
-	name := strings.TrimSuffix(base, ext)
+// activeValues returns the values files whose filename suffix matches the current environment.
+func activeValues(options Options, logger Logger) ([]string, error) {
+	defaults := options
+	defaults.Values = nil
+
+	vars, err := mergeVars(defaults, nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	facts, err := currentFacts(options, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	values := []string{}
 
-	parts := strings.Split(name, "_")
+	for _, file := range options.Values {
+		logger.Printlnf("loading values file %q", file)
 
-	const expectedParts = 2
+		if skipBySuffix(file, facts, logger) {
+			continue
+		}
 
-	if len(parts) < expectedParts {
-		return ""
+		values = append(values, file)
 	}
 
-	platform := parts[len(parts)-1]
-	knownPlatforms := []string{
-		"linux",
-		"darwin",
-		"windows",
-		"freebsd",
-		"openbsd",
-		"netbsd",
-		"dragonfly",
-		"solaris",
-		"aix",
-		"wsl",
-		"docker",
+	return values, nil
+}
+
+// printOverrides prints the command definitions that were replaced by other definitions of the same name.
+//
+//nolint:forbidigo // Function needs to print to the console directly.
+func printOverrides(overrides []override) {
+	fmt.Println("# Overridden definitions:")
+
+	for _, override := range overrides {
+		fmt.Printf("#  %s\n", override)
 	}
 
-	if slices.Contains(knownPlatforms, platform) {
-		return platform
+	fmt.Println()
+}
+
+// skipBySuffix reports whether the file is skipped because a token of its filename suffix
+// does not match the current environment.
+func skipBySuffix(file string, facts filter.Facts, logger Logger) bool {
+	mismatch := suffix.Mismatch(file, facts)
+	if mismatch == "" {
+		return false
 	}
 
-	return ""
+	logger.Printlnf("    - skipping due to %s", mismatch)
+
+	return true
 }
 
 // activePlatformSuffixes returns the filename suffixes that match the current platform.
@@ -184,7 +276,18 @@ func activePlatformSuffixes(operatingSystem string) []string {
 	return platforms
 }
 
-// platformSuffixMatches checks whether a filename suffix applies to the current platform.
-func platformSuffixMatches(suffix, operatingSystem string) bool {
-	return suffix == "" || slices.Contains(activePlatformSuffixes(operatingSystem), suffix)
+// exportOptions returns the options for exporting the commands of a file rendered with the given variables,
+// recording completion stamps of commands that run only once in stamps.
+// Cached outputs are stored under "dotgen" in the cache directory of the file, and warnings go to the logger.
+func exportOptions(options Options, vars variables.Variables, stamps *state.State, logger Logger) dotgen.Options {
+	return dotgen.Options{
+		Shell:       options.Shell,
+		Interpreter: options.Interpreter,
+		Instrument:  options.Instrument,
+		Parallel:    options.Parallel,
+		CacheDir:    filepath.Join(fmt.Sprint(vars["CACHE_DIR"]), "dotgen"),
+		State:       stamps,
+		Refresh:     options.Refresh,
+		Warn:        logger.Warnf,
+	}
 }
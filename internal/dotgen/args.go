@@ -0,0 +1,283 @@
+package dotgen
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// identifier matches valid shell variable names.
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ArgsShells represents the shells supported by the argument parser, which generates POSIX shell code using `local`.
+// Completion is generated for bash and zsh; sh and dash have no programmable completion.
+// Shells with their own function syntax, such as fish, are out of scope, so they get neither parsing nor completion.
+//
+//nolint:gochecknoglobals  // This is a constant list of supported shells.
+var ArgsShells = []string{"sh", "bash", "zsh", "dash"}
+
+// Arg represents a declared argument of a function command.
+type Arg struct {
+	// Name is the name of the argument, also used as the name of the local variable holding it.
+	Name string `yaml:"name"`
+	// Doc is the documentation string for the argument.
+	Doc string `yaml:"doc,omitempty"`
+	// Required indicates that the argument must be provided.
+	Required bool `yaml:"required,omitempty"`
+	// Default is the value used when the argument is not provided.
+	Default string `yaml:"default,omitempty"`
+	// Variadic indicates that the argument takes all remaining arguments. Only the last argument can be variadic.
+	Variadic bool `yaml:"variadic,omitempty"`
+	// Choices restricts the argument to the listed values, and is used for completion.
+	Choices []string `yaml:"choices,omitempty"`
+}
+
+// Args represents the declared arguments of a function command.
+type Args []Arg
+
+// Validate checks the argument declarations for any issues.
+func (a Args) Validate() error {
+	errs := []error{}
+	seen := map[string]bool{}
+	optional := ""
+
+	for i, arg := range a {
+		switch {
+		case !identifier.MatchString(arg.Name):
+			errs = append(errs, fmt.Errorf("argument %q must be a valid shell variable name", arg.Name))
+		case seen[arg.Name]:
+			errs = append(errs, fmt.Errorf("argument %q is declared more than once", arg.Name))
+		}
+
+		seen[arg.Name] = true
+
+		if arg.Required && arg.Default != "" {
+			errs = append(errs, fmt.Errorf("argument %q cannot be required and have a default", arg.Name))
+		}
+
+		if arg.Variadic && i != len(a)-1 {
+			errs = append(errs, fmt.Errorf("argument %q is variadic but not the last argument", arg.Name))
+		}
+
+		if arg.Required && optional != "" {
+			errs = append(errs, fmt.Errorf("required argument %q follows optional argument %q", arg.Name, optional))
+		}
+
+		if !arg.Required {
+			optional = arg.Name
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Usage returns the usage message of a function with these arguments.
+func (a Args) Usage(name, doc string) []string {
+	synopsis := []string{"Usage: " + name}
+
+	for _, arg := range a {
+		placeholder := arg.Name
+		if arg.Variadic {
+			placeholder += "..."
+		}
+
+		if arg.Required {
+			placeholder = "<" + placeholder + ">"
+		} else {
+			placeholder = "[" + placeholder + "]"
+		}
+
+		synopsis = append(synopsis, placeholder)
+	}
+
+	lines := []string{strings.Join(synopsis, " ")}
+
+	if doc = strings.TrimSpace(doc); doc != "" {
+		lines = append(lines, "")
+		lines = append(lines, strings.Split(doc, "\n")...)
+	}
+
+	if len(a) == 0 {
+		return lines
+	}
+
+	lines = append(lines, "", "Arguments:")
+
+	width := 0
+	for _, arg := range a {
+		width = max(width, len(arg.Name))
+	}
+
+	for _, arg := range a {
+		details := []string{}
+
+		if arg.Doc != "" {
+			details = append(details, strings.TrimSpace(arg.Doc))
+		}
+
+		if arg.Required {
+			details = append(details, "(required)")
+		}
+
+		if arg.Default != "" {
+			details = append(details, fmt.Sprintf("(default: %s)", arg.Default))
+		}
+
+		if len(arg.Choices) > 0 {
+			details = append(details, fmt.Sprintf("(one of: %s)", strings.Join(arg.Choices, ", ")))
+		}
+
+		lines = append(lines, strings.TrimRight(fmt.Sprintf("  %-*s  %s", width, arg.Name, strings.Join(details, " ")), " "))
+	}
+
+	return lines
+}
+
+// Parser returns POSIX shell code that handles `-h`/`--help`, checks and assigns the arguments to local variables,
+// for use at the start of the body of the named function. A variadic argument is left in "$@".
+//
+// `-h` and `--help` print the usage anywhere before a `--` argument. A leading `--` is removed,
+// so that all following arguments are taken as values.
+func (a Args) Parser(name, doc string) string {
+	var builder strings.Builder
+
+	usage := "printf '%s\\n' " + quoteAll(a.Usage(name, doc))
+
+	fmt.Fprintf(&builder,
+		"local __dotgen_arg\nfor __dotgen_arg in \"$@\"; do\ncase \"$__dotgen_arg\" in\n--) break ;;\n-h | --help)\n%s\nreturn 0\n;;\nesac\ndone\n",
+		usage,
+	)
+	builder.WriteString("[ \"${1-}\" = \"--\" ] && shift\n")
+
+	for _, arg := range a {
+		missing := fmt.Sprintf(
+			"if [ \"$#\" -lt 1 ]; then\nprintf '%%s\\n' %s >&2\n%s >&2\nreturn 2\nfi\n",
+			quote(fmt.Sprintf("%s: missing required argument %s", name, arg.Name)),
+			usage,
+		)
+
+		invalid := fmt.Sprintf(
+			"printf '%%s\\n' %s >&2\n%s >&2\nreturn 2",
+			quote(fmt.Sprintf("%s: invalid value for %s, must be one of: %s", name, arg.Name, strings.Join(arg.Choices, ", "))),
+			usage,
+		)
+
+		switch {
+		case arg.Variadic:
+			if arg.Required {
+				builder.WriteString(missing)
+			}
+
+			if len(arg.Choices) > 0 {
+				fmt.Fprintf(&builder, "for __dotgen_arg in \"$@\"; do\ncase \"$__dotgen_arg\" in\n%s) ;;\n*)\n%s\n;;\nesac\ndone\n",
+					strings.Join(quoteEach(arg.Choices), " | "), invalid)
+			}
+		case arg.Required:
+			builder.WriteString(missing)
+			fmt.Fprintf(&builder, "local %s=\"$1\"\nshift\n", arg.Name)
+		default:
+			fmt.Fprintf(&builder, "local %s=\"${1-%s}\"\n[ \"$#\" -gt 0 ] && shift\n", arg.Name, escapeDefault(arg.Default))
+		}
+
+		if len(arg.Choices) > 0 && !arg.Variadic {
+			condition := ""
+			if !arg.Required {
+				condition = fmt.Sprintf("[ -n \"$%s\" ] && ", arg.Name)
+			}
+
+			fmt.Fprintf(&builder, "%scase \"$%s\" in\n%s) ;;\n*)\n%s\n;;\nesac\n",
+				condition, arg.Name, strings.Join(quoteEach(arg.Choices), " | "), invalid)
+		}
+	}
+
+	return builder.String()
+}
+
+// Completion returns shell code that completes the choices of the arguments for the named function,
+// or an empty string if no argument has choices or the shell is not supported.
+func (a Args) Completion(name, shell string) string {
+	hasChoices := false
+
+	for _, arg := range a {
+		hasChoices = hasChoices || len(arg.Choices) > 0
+	}
+
+	if !hasChoices {
+		return ""
+	}
+
+	function := "_dotgen_complete_" + toShellVar(name)
+
+	switch shell {
+	case "bash":
+		var cases strings.Builder
+
+		for i, arg := range a {
+			if len(arg.Choices) == 0 {
+				continue
+			}
+
+			position := fmt.Sprintf("%d", i+1)
+			if arg.Variadic {
+				position = "*"
+			}
+
+			fmt.Fprintf(&cases, "%s) mapfile -t COMPREPLY < <(compgen -W %s -- \"$cur\") ;;\n",
+				position, quote(strings.Join(arg.Choices, " ")))
+		}
+
+		return fmt.Sprintf(
+			"%s() {\nlocal cur=\"${COMP_WORDS[COMP_CWORD]}\"\ncase \"$COMP_CWORD\" in\n%sesac\n}\ncomplete -F %s %s\n",
+			function, cases.String(), function, name,
+		)
+	case "zsh":
+		specs := []string{}
+
+		for i, arg := range a {
+			choices := ""
+			if len(arg.Choices) > 0 {
+				choices = "(" + strings.Join(arg.Choices, " ") + ")"
+			}
+
+			position := fmt.Sprintf("%d", i+1)
+			if arg.Variadic {
+				position = "*"
+			}
+
+			specs = append(specs, quote(fmt.Sprintf("%s:%s:%s", position, arg.Name, choices)))
+		}
+
+		return fmt.Sprintf(
+			"%s() {\n_arguments %s\n}\nif command -v compdef >/dev/null 2>&1; then\ncompdef %s %s\nfi\n",
+			function, strings.Join(specs, " "), function, name,
+		)
+	default:
+		return ""
+	}
+}
+
+// quote quotes a string for use as a single shell word.
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// quoteEach quotes each string for use as a single shell word.
+func quoteEach(values []string) []string {
+	quoted := make([]string, 0, len(values))
+	for _, value := range values {
+		quoted = append(quoted, quote(value))
+	}
+
+	return quoted
+}
+
+// quoteAll quotes each string and joins them as separate shell words.
+func quoteAll(values []string) string {
+	return strings.Join(quoteEach(values), " ")
+}
+
+// escapeDefault escapes a default value for use inside a double-quoted "${1-...}" expansion.
+func escapeDefault(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`", "}", `\}`).Replace(value)
+}
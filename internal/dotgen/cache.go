@@ -0,0 +1,42 @@
+package dotgen
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/idelchi/dotgen/internal/cache"
+	"github.com/idelchi/dotgen/internal/dependency"
+)
+
+// Cache represents the caching settings of a "run" command.
+type Cache struct {
+	// TTL is how long a cached output is reused. Empty means it is reused until its key changes.
+	TTL string `yaml:"ttl,omitempty"`
+	// Dependencies contains external inputs that invalidate the cached output when they change.
+	Dependencies dependency.Dependencies `yaml:"dependencies,omitempty"`
+}
+
+// ttl parses the TTL of the cache.
+func (c Cache) ttl() (time.Duration, error) {
+	if c.TTL == "" {
+		return 0, nil
+	}
+
+	ttl, err := parseDuration(c.TTL)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cache ttl %q: %w", c.TTL, err)
+	}
+
+	return ttl, nil
+}
+
+// key returns the cache key of a command, derived from its inputs and the dependencies.
+// Relative dependency files are resolved against dir.
+func (c Cache) key(dir string, inputs ...string) (string, error) {
+	records, err := c.Dependencies.Fingerprints(dir)
+	if err != nil {
+		return "", err //nolint:wrapcheck // Error is already descriptive enough.
+	}
+
+	return cache.Key(append(inputs, records...)...), nil
+}
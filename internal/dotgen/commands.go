@@ -1,15 +1,25 @@
 package dotgen
 
 import (
+	"cmp"
+	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"slices"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/idelchi/dotgen/internal/atomicfile"
+	"github.com/idelchi/dotgen/internal/cache"
 	"github.com/idelchi/dotgen/internal/exclusion"
+	"github.com/idelchi/dotgen/internal/filter"
 	"github.com/idelchi/dotgen/internal/format"
+	"github.com/idelchi/dotgen/internal/order"
+	"github.com/idelchi/dotgen/internal/state"
 	"github.com/idelchi/dotgen/pkg/exec"
 )
 
@@ -23,16 +33,54 @@ type Command struct {
 	Cmd string `yaml:"cmd"`
 	// Kind is the type of command: "alias", "function", "raw", or "run".
 	Kind string `yaml:"kind,omitempty"`
-	// ExportTo is the path to export the command output.
+	// Args declares the arguments of "function" commands, used to generate argument parsing, usage and completion.
+	Args Args `yaml:"args,omitempty"`
+	// Mode is the octal file mode of the export_to file, such as "0644". Defaults to "0600".
+	Mode string `yaml:"mode,omitempty"`
+	// Interval runs "raw" commands at most once per interval when the shell starts, such as "7d".
+	Interval string `yaml:"interval,omitempty"`
+	// Background runs "raw" commands with an interval in the background, detached from the shell.
+	Background bool `yaml:"background,omitempty"`
+	// Lazy lists the names of stub functions that load "raw" or "run" commands on first use.
+	Lazy []string `yaml:"lazy,omitempty"`
+	// Defer delays loading the command until after the first prompt appears.
+	Defer bool `yaml:"defer,omitempty"`
+	// ExportTo is the path to export the command output or definition to, replacing it by a line sourcing the file.
 	ExportTo string `yaml:"export_to,omitempty"`
-	// Shell specifies the shells for which this command is applicable.
-	Shell []string `yaml:"shell,omitempty"`
-	// OS specifies the operating systems for which this command is applicable.
-	OS []string `yaml:"os,omitempty"`
+	// Scope specifies the environments for which this command is applicable.
+	filter.Scope `yaml:",inline"`
 	// Exclude specifies whether to exclude this command from the output.
 	Exclude exclusion.Exclude `yaml:"exclude,omitempty"`
 	// Timeout specifies the timeout for "run" commands.
 	Timeout string `yaml:"timeout,omitempty"`
+	// Once runs "run" commands only until they first succeed, or again when their command text changes.
+	Once Once `yaml:"once,omitempty"`
+	// Cache enables caching the output of "run" commands.
+	Cache *Cache `yaml:"cache,omitempty"`
+	// Interpreter executes "run" commands instead of the shell, such as "bash", "python3 -c" or "python3 -".
+	Interpreter string `yaml:"interpreter,omitempty"`
+	// Dir is the working directory of "run" commands, relative to the file declaring the command.
+	Dir string `yaml:"dir,omitempty"`
+	// Env holds environment variables for "run" commands, merged into the inherited environment.
+	Env Env `yaml:"env,omitempty"`
+	// CleanEnv runs "run" commands with only the variables from Env, instead of the inherited environment.
+	CleanEnv bool `yaml:"clean_env,omitempty"`
+	// Stdin is the standard input of "run" commands.
+	Stdin string `yaml:"stdin,omitempty"`
+	// OnError is the policy for failing "run" commands: "fail", "skip" or "warn". Defaults to "fail".
+	OnError string `yaml:"on_error,omitempty"`
+	// Retries is how many times a failing "run" command is retried.
+	Retries int `yaml:"retries,omitempty"`
+	// RetryDelay is how long to wait between retries.
+	RetryDelay string `yaml:"retry_delay,omitempty"`
+	// ExpectExit lists the exit codes that count as success for "run" commands. Defaults to 0.
+	ExpectExit []int `yaml:"expect_exit,omitempty"`
+	// Override marks this definition as the one to keep when the name is defined more than once.
+	Override bool `yaml:"override,omitempty"`
+	// Constraints lists the commands, in this or other files, that this command must come after or before.
+	order.Constraints `yaml:",inline"`
+	// Source is the configuration file declaring the command.
+	Source string `yaml:"-"`
 }
 
 // parseTimeout parses a timeout string into a time.Duration.
@@ -45,10 +93,10 @@ func parseTimeout(timeout string) (time.Duration, error) {
 		return 1 * time.Minute, nil
 	}
 
-	duration, err := time.ParseDuration(timeout)
+	duration, err := parseDuration(timeout)
 	if err != nil {
 		return 0, fmt.Errorf(
-			"invalid timeout format %q (expected Go duration format like \"30s\", \"5m\", \"1h30m\"): %w",
+			"invalid timeout format %q (expected a duration like \"30s\", \"5m\", \"1h30m\" or \"1d\"): %w",
 			timeout,
 			err,
 		)
@@ -57,10 +105,149 @@ func parseTimeout(timeout string) (time.Duration, error) {
 	return duration, nil
 }
 
+// Validate checks the settings of the command for any issues. The kind must already be valid.
+func (c *Command) Validate() error {
+	errs := []error{}
+
+	only := func(setting string, set bool, kinds ...string) {
+		if set && !slices.Contains(kinds, c.Kind) {
+			errs = append(errs, fmt.Errorf("command %q declares %s, which is only supported for kinds %q", c.Name, setting, kinds))
+		}
+	}
+
+	only("args", len(c.Args) > 0, Function)
+	only("lazy", len(c.Lazy) > 0, Raw, Run)
+	only("cache", c.Cache != nil, Run)
+	only("once", c.Once.Enabled, Run)
+	only("interval", c.Interval != "", Raw)
+	only("background", c.Background, Raw)
+	only("on_error", c.OnError != "", Run)
+	only("retries", c.Retries != 0, Run)
+	only("retry_delay", c.RetryDelay != "", Run)
+	only("expect_exit", len(c.ExpectExit) > 0, Run)
+	only("dir", c.Dir != "", Run)
+	only("env", len(c.Env) > 0, Run)
+	only("clean_env", c.CleanEnv, Run)
+	only("stdin", c.Stdin != "", Run)
+	only("interpreter", c.Interpreter != "", Run)
+
+	switch {
+	case c.Background && c.Interval == "":
+		errs = append(errs, fmt.Errorf("command %q declares background, which requires interval", c.Name))
+	case c.Interval != "" && len(c.Lazy) > 0:
+		errs = append(errs, fmt.Errorf("command %q cannot declare both interval and lazy", c.Name))
+	}
+
+	if _, err := parseInterval(c.Interval); err != nil {
+		errs = append(errs, fmt.Errorf("command %q: %w", c.Name, err))
+	}
+
+	if c.Once.Enabled && c.ExportTo == "" {
+		errs = append(errs, fmt.Errorf(
+			"command %q declares once, which requires export_to (a file, or /dev/null to discard the output)",
+			c.Name,
+		))
+	}
+
+	if _, err := parseMode(c.Mode); err != nil {
+		errs = append(errs, fmt.Errorf("command %q: %w", c.Name, err))
+	}
+
+	if c.Stdin != "" && exec.ReadsStdin(c.Interpreter) {
+		errs = append(errs, fmt.Errorf("command %q declares stdin, but interpreter %q reads the script from stdin", c.Name, c.Interpreter))
+	}
+
+	if err := c.Args.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("command %q: %w", c.Name, err))
+	}
+
+	switch {
+	case len(c.Lazy) > 0 && c.ExportTo == "/dev/null":
+		errs = append(errs, fmt.Errorf("command %q declares lazy, but its output is discarded", c.Name))
+	case slices.Contains(c.Lazy, ""):
+		errs = append(errs, fmt.Errorf("command %q declares an empty lazy name", c.Name))
+	}
+
+	if c.Cache != nil {
+		if _, err := c.Cache.ttl(); err != nil {
+			errs = append(errs, fmt.Errorf("command %q: %w", c.Name, err))
+		}
+	}
+
+	if _, err := c.Env.Sorted(); err != nil {
+		errs = append(errs, fmt.Errorf("command %q: %w", c.Name, err))
+	}
+
+	if c.OnError != "" && !slices.Contains(OnErrorPolicies, c.OnError) {
+		errs = append(errs, fmt.Errorf("command %q has invalid on_error %q, must be one of %v", c.Name, c.OnError, OnErrorPolicies))
+	}
+
+	if c.Retries < 0 {
+		errs = append(errs, fmt.Errorf("command %q has negative retries %d", c.Name, c.Retries))
+	}
+
+	if _, err := parseDelay(c.RetryDelay); err != nil {
+		errs = append(errs, fmt.Errorf("command %q: %w", c.Name, err))
+	}
+
+	return errors.Join(errs...)
+}
+
+// parseMode parses an octal file mode string into an fs.FileMode.
+// If the mode string is empty, it defaults to 0600.
+func parseMode(mode string) (fs.FileMode, error) {
+	mode = strings.TrimSpace(mode)
+
+	if mode == "" {
+		return 0o600, nil
+	}
+
+	parsed, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || parsed > 0o777 {
+		return 0, fmt.Errorf("invalid mode %q (expected octal permissions like \"0644\")", mode)
+	}
+
+	return fs.FileMode(parsed), nil
+}
+
+// parseInterval parses an interval string into a time.Duration.
+// If the interval string is empty, it returns zero.
+func parseInterval(interval string) (time.Duration, error) {
+	interval = strings.TrimSpace(interval)
+
+	if interval == "" {
+		return 0, nil
+	}
+
+	duration, err := parseDuration(interval)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("invalid interval %q (expected a positive duration like \"12h\", \"7d\" or \"2w\")", interval)
+	}
+
+	return duration, nil
+}
+
+// parseDelay parses a retry delay string into a time.Duration.
+// If the delay string is empty, it defaults to no delay.
+func parseDelay(delay string) (time.Duration, error) {
+	delay = strings.TrimSpace(delay)
+
+	if delay == "" {
+		return 0, nil
+	}
+
+	duration, err := parseDuration(delay)
+	if err != nil {
+		return 0, fmt.Errorf("invalid retry_delay %q: %w", delay, err)
+	}
+
+	return duration, nil
+}
+
 // Export returns a string representation of the command, suitable for shell usage.
 //
 //nolint:gocognit,funlen // TODO(Idelchi): Refactor.
-func (c *Command) Export(shell string) (string, error) {
+func (c *Command) Export(ctx context.Context, options Options) (string, error) {
 	name := strings.TrimSpace(c.Name)
 	cmd := strings.TrimSpace(c.Cmd)
 	doc := strings.ReplaceAll(strings.TrimSpace(c.Doc), "\n", "\n#  ")
@@ -85,9 +272,17 @@ func (c *Command) Export(shell string) (string, error) {
 		fmt.Fprintf(&builder, "alias %s='%s'", name, strings.TrimRight(cmd, "\n"))
 		fmt.Fprint(&builder, "\n")
 
-		return builder.String(), nil
+		return c.export(name, builder.String(), options.Shell)
 	case Function:
-		function := fmt.Sprintf("%s() {\n%s\n}\n", name, cmd)
+		if len(c.Args) > 0 {
+			if !slices.Contains(ArgsShells, options.Shell) {
+				return "", fmt.Errorf("command %q declares args, which are only supported for shells %q", name, ArgsShells)
+			}
+
+			cmd = c.Args.Parser(name, c.Doc) + cmd
+		}
+
+		function := fmt.Sprintf("%s() {\n%s\n}\n", name, cmd) + c.Args.Completion(name, options.Shell)
 
 		var builder strings.Builder
 
@@ -108,7 +303,7 @@ func (c *Command) Export(shell string) (string, error) {
 			function = formatted
 		}
 
-		return function, nil
+		return c.export(name, function, options.Shell)
 	case Raw:
 		raw := c.Cmd
 
@@ -122,6 +317,23 @@ func (c *Command) Export(shell string) (string, error) {
 			fmt.Fprintf(&builder, "#  %s\n", doc)
 		}
 
+		if c.Interval != "" {
+			if !slices.Contains(IntervalShells, options.Shell) {
+				return "", fmt.Errorf("command %q declares interval, which is only supported for shells %q", name, IntervalShells)
+			}
+
+			every, err := parseInterval(c.Interval)
+			if err != nil {
+				return "", fmt.Errorf("command %q: %w", name, err)
+			}
+
+			raw = Interval(name, raw, filepath.Join(options.CacheDir, "intervals", toShellVar(name)), every, c.Background)
+		}
+
+		if c.ExportPath() == "" {
+			raw = c.lazy(name, raw)
+		}
+
 		fmt.Fprint(&builder, raw)
 
 		raw = builder.String()
@@ -131,22 +343,20 @@ func (c *Command) Export(shell string) (string, error) {
 			raw = formatted
 		}
 
-		return raw, nil
+		return c.export(name, raw, options.Shell)
 
 	case Run:
-		timeout, err := parseTimeout(c.Timeout)
-		if err != nil {
-			return "", fmt.Errorf("parsing timeout for command %q: %w", name, err)
-		}
+		hash := cache.Key(cmd)
 
-		result := exec.Run(
-			shell,
-			cmd,
-			timeout,
-		)
+		if c.Once.Enabled && options.State != nil {
+			if stamp, done := options.State.Done(c.onceKey(), hash); done {
+				return c.ran(name, cmd, stamp, options.Shell), nil
+			}
+		}
 
-		if result.Err != nil {
-			return "", fmt.Errorf("executing command %q: %w: %v", name, result.Err, result.Stderr)
+		stdout, err := c.run(ctx, name, cmd, options)
+		if err != nil && (c.OnError == "" || c.OnError == OnErrorFail || ctx.Err() != nil) {
+			return "", err
 		}
 
 		var builder strings.Builder
@@ -164,23 +374,35 @@ func (c *Command) Export(shell string) (string, error) {
 		fmt.Fprint(&builder, "# original:\n")
 		fmt.Fprintf(&builder, "#  %s\n", cmd)
 
+		if err != nil {
+			builder.WriteString(c.failure(name, err))
+
+			return builder.String(), nil
+		}
+
 		switch c.ExportTo {
 		case "/dev/null":
 			builder.WriteString("# output discarded\n")
 		case "":
-			builder.WriteString(result.Stdout)
+			builder.WriteString(c.lazy(name, stdout))
 		default:
-			exportTo := os.ExpandEnv(c.ExportTo)
-			fmt.Fprintf(&builder, "# output exported to %q\n", exportTo)
-			fmt.Fprintf(&builder, ". %q\n", exportTo)
+			exportTo := c.ExportPath()
 
-			if err := os.MkdirAll(filepath.Dir(exportTo), 0o700); err != nil {
-				return "", fmt.Errorf("creating directories for %q: %w", exportTo, err)
+			mode, err := parseMode(c.Mode)
+			if err != nil {
+				return "", fmt.Errorf("command %q: %w", name, err)
 			}
 
-			if err := os.WriteFile(exportTo, []byte(result.Stdout), 0o600); err != nil {
+			if _, err := atomicfile.Write(exportTo, []byte(stdout), mode); err != nil {
 				return "", fmt.Errorf("writing output to %q: %w", exportTo, err)
 			}
+
+			fmt.Fprintf(&builder, "# output exported to %q\n", exportTo)
+			builder.WriteString(c.lazy(name, source(options.Shell, exportTo)))
+		}
+
+		if c.Once.Enabled && options.State != nil {
+			options.State.Record(c.onceKey(), hash)
 		}
 
 		return builder.String(), nil
@@ -189,21 +411,267 @@ func (c *Command) Export(shell string) (string, error) {
 	}
 }
 
-// IsExcluded checks if the command should be excluded based on the provided platforms and shell.
-func (c *Command) IsExcluded(platforms []string, shell string) bool {
-	if c.Exclude.IsExcluded() {
-		return true
+// onceKey returns the key of the completion stamp of the command.
+func (c *Command) onceKey() string {
+	return cmp.Or(c.Once.Key, strings.TrimSpace(c.Name))
+}
+
+// ran returns the output of a "run" command that is skipped because it already ran once.
+// If its output was exported to a file that still exists, the file is sourced.
+func (c *Command) ran(name, cmd string, stamp state.Stamp, shell string) string {
+	var builder strings.Builder
+
+	fmt.Fprintf(&builder, "# name: %s\n", name)
+	fmt.Fprintf(&builder, "# kind: %s\n", c.Kind)
+	fmt.Fprint(&builder, "# original:\n")
+	fmt.Fprintf(&builder, "#  %s\n", strings.ReplaceAll(cmd, "\n", "\n#  "))
+	fmt.Fprintf(&builder, "# skipped, already ran once (key %q, at %s)\n", c.onceKey(), stamp.Time.Format(time.RFC3339))
+
+	if exportTo := c.ExportPath(); exportTo != "" {
+		if _, err := os.Stat(exportTo); err == nil {
+			fmt.Fprintf(&builder, "# output exported to %q\n", exportTo)
+			builder.WriteString(c.lazy(name, source(shell, exportTo)))
+		}
+	}
+
+	return builder.String()
+}
+
+// export applies export_to to the rendered definition of an "alias", "function" or "raw" command.
+// The definition is returned as is, discarded, or written to the export_to file and replaced by a line sourcing it.
+func (c *Command) export(name, definition, shell string) (string, error) {
+	if c.ExportTo == "" {
+		return definition, nil
+	}
+
+	var builder strings.Builder
+
+	fmt.Fprintf(&builder, "# name: %s\n", name)
+	fmt.Fprintf(&builder, "# kind: %s\n", c.Kind)
+
+	if c.ExportTo == "/dev/null" {
+		builder.WriteString("# output discarded\n")
+
+		return builder.String(), nil
+	}
+
+	exportTo := c.ExportPath()
+
+	mode, err := parseMode(c.Mode)
+	if err != nil {
+		return "", fmt.Errorf("command %q: %w", name, err)
+	}
+
+	if _, err := atomicfile.Write(exportTo, []byte(definition), mode); err != nil {
+		return "", fmt.Errorf("writing output to %q: %w", exportTo, err)
+	}
+
+	fmt.Fprintf(&builder, "# output exported to %q\n", exportTo)
+	builder.WriteString(c.lazy(name, source(shell, exportTo)))
+
+	return builder.String(), nil
+}
+
+// source returns the line sourcing the file in the given shell.
+func source(shell, path string) string {
+	switch shell {
+	case "fish", "nu":
+		return fmt.Sprintf("source %q\n", path)
+	default:
+		return fmt.Sprintf(". %q\n", path)
+	}
+}
+
+// run executes the command and returns its output.
+// If caching is enabled, an unexpired output cached under the same key is reused unless a refresh is requested,
+// and an expired one is used with a warning if the command fails.
+func (c *Command) run(ctx context.Context, name, cmd string, options Options) (string, error) {
+	timeout, err := parseTimeout(c.Timeout)
+	if err != nil {
+		return "", fmt.Errorf("parsing timeout for command %q: %w", name, err)
+	}
+
+	execOptions, err := c.execOptions()
+	if err != nil {
+		return "", fmt.Errorf("command %q: %w", name, err)
+	}
+
+	interpreter := cmp.Or(c.Interpreter, options.Interpreter)
+
+	// Without an explicit interpreter, the output shell runs the snippet with -c, whether or not it is a known shell.
+	if interpreter == "" && options.Shell != "" {
+		interpreter = options.Shell + " -c"
+	}
+
+	store := cache.Store{Dir: options.CacheDir}
+
+	var key string
+
+	if c.Cache != nil {
+		ttl, err := c.Cache.ttl()
+		if err != nil {
+			return "", fmt.Errorf("command %q: %w", name, err)
+		}
+
+		key, err = c.Cache.key(
+			filepath.Dir(c.Source),
+			cmd,
+			options.Shell,
+			interpreter,
+			execOptions.Dir,
+			c.Env.Export(),
+			strconv.FormatBool(c.CleanEnv),
+			c.Stdin,
+		)
+		if err != nil {
+			return "", fmt.Errorf("computing cache key for command %q: %w", name, err)
+		}
+
+		if output, ok := store.Get(key, ttl); ok && !options.Refresh {
+			return output, nil
+		}
+	}
+
+	delay, err := parseDelay(c.RetryDelay)
+	if err != nil {
+		return "", fmt.Errorf("command %q: %w", name, err)
+	}
+
+	expected := c.ExpectExit
+	if len(expected) == 0 {
+		expected = []int{0}
+	}
+
+	var result *exec.Result
+
+	for attempt := range c.Retries + 1 {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return "", fmt.Errorf("executing command %q: %w", name, context.Cause(ctx))
+			case <-time.After(delay):
+			}
+		}
+
+		result = exec.Run(
+			ctx,
+			interpreter,
+			cmd,
+			timeout,
+			execOptions,
+		)
+
+		if (result.ExitCode >= 0 && slices.Contains(expected, result.ExitCode)) || ctx.Err() != nil {
+			break
+		}
+	}
+
+	if result.ExitCode < 0 || !slices.Contains(expected, result.ExitCode) {
+		if result.Err == nil {
+			result.Err = fmt.Errorf("unexpected exit status %d, expected one of %v", result.ExitCode, expected)
+		}
+
+		err := fmt.Errorf("executing command %q: %w: %v", name, result.Err, result.Stderr)
+		if c.Retries > 0 {
+			err = fmt.Errorf("executing command %q (%d attempts): %w: %v", name, c.Retries+1, result.Err, result.Stderr)
+		}
+
+		if c.Cache != nil && ctx.Err() == nil {
+			if output, stored, ok := store.Stale(key); ok {
+				options.warn("using cached output from %s: %v", stored.Format(time.RFC3339), err)
+
+				return output, nil
+			}
+		}
+
+		return "", err
+	}
+
+	if c.Cache != nil {
+		if err := store.Put(key, result.Stdout); err != nil {
+			return "", fmt.Errorf("caching output of command %q: %w", name, err)
+		}
+	}
+
+	return result.Stdout, nil
+}
+
+// execOptions returns the working directory, environment and standard input for executing a "run" command.
+func (c *Command) execOptions() (exec.Options, error) {
+	options := exec.Options{Stdin: c.Stdin}
+
+	if c.Dir != "" {
+		options.Dir = os.ExpandEnv(c.Dir)
+
+		if !filepath.IsAbs(options.Dir) && c.Source != "" {
+			options.Dir = filepath.Join(filepath.Dir(c.Source), options.Dir)
+		}
 	}
 
-	if len(c.OS) > 0 && !slices.ContainsFunc(c.OS, func(platform string) bool {
-		return slices.Contains(platforms, platform)
-	}) {
-		return true
+	if len(c.Env) == 0 && !c.CleanEnv {
+		return options, nil
 	}
 
-	if len(c.Shell) > 0 && !slices.Contains(c.Shell, shell) {
-		return true
+	base := os.Environ()
+	if c.CleanEnv {
+		base = []string{}
 	}
 
-	return false
+	env, err := c.Env.Environ(base)
+	if err != nil {
+		return options, err
+	}
+
+	options.Env = env
+
+	return options, nil
+}
+
+// failure returns the output replacing that of a failed "run" command, according to its on_error policy.
+// With "warn", the output prints the error once when the shell loads.
+func (c *Command) failure(name string, err error) string {
+	message := strings.TrimSpace(err.Error())
+
+	var builder strings.Builder
+
+	fmt.Fprintf(&builder, "# failed (on_error: %s):\n", c.OnError)
+	fmt.Fprintf(&builder, "#  %s\n", strings.ReplaceAll(message, "\n", "\n#  "))
+
+	if c.OnError == OnErrorWarn {
+		lines := append([]string{fmt.Sprintf("[dotgen]: warning: %q failed to load:", name)}, strings.Split(message, "\n")...)
+
+		fmt.Fprintf(&builder, "printf '%%s\\n' %s >&2\n", quoteAll(lines))
+	}
+
+	return builder.String()
+}
+
+// lazy wraps the code in lazy-loading stubs if the command declares any.
+func (c *Command) lazy(name, code string) string {
+	if len(c.Lazy) == 0 {
+		return code
+	}
+
+	code = Lazy(name, c.Lazy, code)
+
+	if formatted, err := format.Shell(code, false); err == nil {
+		return formatted
+	}
+
+	return code
+}
+
+// ExportPath returns the path of the file the command exports its output to,
+// or an empty string if the output is not exported to a file.
+func (c *Command) ExportPath() string {
+	if c.ExportTo == "" || c.ExportTo == "/dev/null" {
+		return ""
+	}
+
+	return os.ExpandEnv(c.ExportTo)
+}
+
+// IsExcluded checks if the command should be excluded based on its exclusion conditions and scope.
+func (c *Command) IsExcluded(facts filter.Facts) bool {
+	return c.Exclude.IsExcluded() || !c.Matches(facts)
 }
@@ -0,0 +1,65 @@
+package dotgen_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/idelchi/dotgen/internal/dotgen"
+)
+
+func TestRunExportToSourcesFile(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		shell string
+		want  string
+	}{
+		{shell: "bash", want: ". %q"},
+		{shell: "zsh", want: ". %q"},
+		{shell: "fish", want: "source %q"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.shell, func(t *testing.T) {
+			t.Parallel()
+
+			exportTo := filepath.Join(t.TempDir(), "out", "foo.sh")
+
+			config, err := dotgen.New(fmt.Appendf(nil, `
+commands:
+  - name: gen
+    kind: run
+    cmd: echo 'export FOO=1'
+    export_to: %s
+`, exportTo))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := config.Validate(); err != nil {
+				t.Fatal(err)
+			}
+
+			output, err := config.Commands[0].Export(t.Context(), dotgen.Options{Shell: tt.shell, Interpreter: "sh"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want := fmt.Sprintf(tt.want, exportTo); !strings.Contains(output, want) {
+				t.Errorf("output does not source the exported file with %q:\n%s", want, output)
+			}
+
+			data, err := os.ReadFile(exportTo)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := strings.TrimSpace(string(data)); got != "export FOO=1" {
+				t.Errorf("exported file contains %q, want %q", got, "export FOO=1")
+			}
+		})
+	}
+}
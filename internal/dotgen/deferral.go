@@ -0,0 +1,111 @@
+package dotgen
+
+import (
+	"fmt"
+	"strings"
+)
+
+// deferralRunner is the shell code shared by all files, which runs the queued functions once.
+// Functions queued more than once, such as when the output is sourced again before the first prompt, run only once.
+const deferralRunner = `
+__dotgen_deferred_run() {
+  local __dotgen_deferred_function
+  for __dotgen_deferred_function in "${__dotgen_deferred[@]}"; do
+    typeset -f "$__dotgen_deferred_function" >/dev/null 2>&1 || continue
+    "$__dotgen_deferred_function"
+    unset -f "$__dotgen_deferred_function"
+  done
+  __dotgen_deferred=()
+}
+`
+
+// deferralHooks maps each supported shell to the code that runs the queue after the next prompt.
+// The hooks unregister themselves once they ran, and are registered again when the output is sourced again.
+//
+//nolint:gochecknoglobals // This is a constant lookup table of shell hooks.
+var deferralHooks = map[string]string{
+	// zsh: precmd runs right before the first prompt is drawn, and registers a zle file descriptor handler
+	// on an immediately readable descriptor, which zle calls once the prompt is displayed.
+	"zsh": `
+__dotgen_deferred_precmd() {
+  precmd_functions=(${precmd_functions:#__dotgen_deferred_precmd})
+  exec {__dotgen_deferred_fd}< <(:)
+  if ! zle -F "$__dotgen_deferred_fd" __dotgen_deferred_zle 2>/dev/null; then
+    exec {__dotgen_deferred_fd}<&-
+    __dotgen_deferred_run
+  fi
+}
+__dotgen_deferred_zle() {
+  zle -F "$1"
+  exec {__dotgen_deferred_fd}<&-
+  __dotgen_deferred_run
+  zle reset-prompt 2>/dev/null
+}
+case " ${precmd_functions[*]} " in
+  *" __dotgen_deferred_precmd "*) ;;
+  *) precmd_functions+=(__dotgen_deferred_precmd) ;;
+esac
+`,
+	// bash: the next PROMPT_COMMAND runs the queue and removes itself.
+	"bash": `
+__dotgen_deferred_prompt() {
+  PROMPT_COMMAND="${PROMPT_COMMAND#__dotgen_deferred_prompt;}"
+  __dotgen_deferred_run
+}
+case ";${PROMPT_COMMAND:-}" in
+  *";__dotgen_deferred_prompt;"*) ;;
+  *) PROMPT_COMMAND="__dotgen_deferred_prompt;${PROMPT_COMMAND:-}" ;;
+esac
+`,
+}
+
+// Defer returns shell code that queues the exported commands of a file to run after the first prompt appears.
+// The queue is shared across files and runs in the order commands are queued.
+// Shells without a supported prompt hook load the commands immediately.
+func Defer(shell, file string, commands []commandExport, instrumentation Instrumentation) string {
+	var builder strings.Builder
+
+	builder.WriteString("\n# Deferred commands\n")
+	builder.WriteString("# ------------------------------------------------\n")
+
+	hook, ok := deferralHooks[shell]
+	if !ok {
+		fmt.Fprintf(&builder, "# deferred loading is not supported for %q, loading immediately\n", shell)
+
+		for _, c := range commands {
+			builder.WriteString(instrumentation.Wrap(c.name, c.command))
+			builder.WriteString("\n")
+		}
+
+		builder.WriteString(instrumentation.Footer())
+		builder.WriteString("# ------------------------------------------------\n")
+
+		return builder.String()
+	}
+
+	prefix := fmt.Sprintf("__dotgen_deferred_%s", toShellVar(file))
+	queued := []string{}
+
+	for _, c := range commands {
+		function := fmt.Sprintf("%s_%s", prefix, toShellVar(c.name))
+		queued = append(queued, function)
+
+		fmt.Fprintf(&builder, "%s() {\n%s\n}\n\n", function, strings.TrimSpace(instrumentation.Wrap(c.name, c.command)))
+	}
+
+	if instrumentation.Enabled {
+		function := prefix + "_instrumentation"
+		queued = append(queued, function)
+
+		fmt.Fprintf(&builder, "%s() {\n%s\n}\n\n", function, strings.TrimSpace(instrumentation.Footer()))
+	}
+
+	fmt.Fprintf(&builder, "__dotgen_deferred+=(%s)\n", strings.Join(queued, " "))
+
+	builder.WriteString(strings.TrimSpace(deferralRunner) + "\n")
+	builder.WriteString(strings.TrimSpace(hook) + "\n")
+
+	builder.WriteString("# ------------------------------------------------\n")
+
+	return builder.String()
+}
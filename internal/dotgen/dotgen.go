@@ -2,13 +2,19 @@ package dotgen
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"go.yaml.in/yaml/v4"
+
+	"github.com/idelchi/dotgen/internal/filter"
+	"github.com/idelchi/dotgen/internal/order"
+	"github.com/idelchi/dotgen/internal/ordered"
 )
 
 // Dotgen represents the root structure of an dotgen configuration file.
@@ -19,13 +25,16 @@ type Dotgen struct {
 	Env Env `yaml:"env,omitempty"`
 	// Commands holds the command definitions.
 	Commands []Command `yaml:"commands,omitempty"`
+	// Files holds the files rendered from templates.
+	Files []File `yaml:"files,omitempty"`
 }
 
 // commandExport holds the rendered output for one command.
 type commandExport struct {
-	name    string
-	command string
-	err     error
+	name     string
+	command  string
+	deferred bool
+	err      error
 }
 
 // New parses the provided YAML data into the Dotgen structure.
@@ -53,65 +62,352 @@ func (a Dotgen) Validate() error {
 				errs,
 				fmt.Errorf("command %q has invalid kind %q, must be one of %v", command.Name, command.Kind, Kinds),
 			)
+
+			continue
+		}
+
+		if err := a.Commands[i].Validate(); err != nil {
+			errs = append(errs, err)
 		}
 	}
 
+	for i := range a.Files {
+		if err := a.Files[i].Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if _, err := a.Env.Sorted(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := a.Vars.Sorted(); err != nil {
+		errs = append(errs, err)
+	}
+
 	return errors.Join(errs...)
 }
 
-// Filtered returns a new Dotgen instance with commands filtered based on the provided platforms and shell.
-func (a Dotgen) Filtered(platforms []string, shell string) (dotgen Dotgen) {
+// Filtered returns a new Dotgen instance with commands and files filtered based on the provided facts.
+func (a Dotgen) Filtered(facts filter.Facts) (dotgen Dotgen) {
 	for _, c := range a.Commands {
-		if c.IsExcluded(platforms, shell) {
+		if c.IsExcluded(facts) {
 			continue
 		}
 
 		dotgen.Commands = append(dotgen.Commands, c)
 	}
 
+	for _, f := range a.Files {
+		if f.IsExcluded(facts) {
+			continue
+		}
+
+		dotgen.Files = append(dotgen.Files, f)
+	}
+
 	dotgen.Env = a.Env
 	dotgen.Vars = a.Vars
 
 	return dotgen
 }
 
+// Tagged returns a new Dotgen instance with the given tags added to the tags of every command and file.
+func (a Dotgen) Tagged(tags []string) Dotgen {
+	if len(tags) == 0 {
+		return a
+	}
+
+	dotgen := a
+	dotgen.Commands = slices.Clone(a.Commands)
+	dotgen.Files = slices.Clone(a.Files)
+
+	for i, c := range dotgen.Commands {
+		dotgen.Commands[i].Tags = withTags(tags, c.Tags)
+	}
+
+	for i, f := range dotgen.Files {
+		dotgen.Files[i].Tags = withTags(tags, f.Tags)
+	}
+
+	return dotgen
+}
+
+// withTags returns the given tags followed by the own tags that are not among them.
+func withTags(tags, own []string) []string {
+	merged := slices.Clone(tags)
+
+	for _, tag := range own {
+		if !slices.Contains(merged, tag) {
+			merged = append(merged, tag)
+		}
+	}
+
+	return merged
+}
+
+// Merge returns a new Dotgen instance with the configuration of other merged over this one.
+// Env and vars entries of other replace same-named entries in place, and its commands and files are appended.
+func (a Dotgen) Merge(other Dotgen) (dotgen Dotgen) {
+	dotgen.Env = slices.Clone(a.Env)
+	dotgen.Vars = slices.Clone(a.Vars)
+	dotgen.Commands = slices.Concat(a.Commands, other.Commands)
+	dotgen.Files = slices.Concat(a.Files, other.Files)
+
+	for _, pair := range other.Env {
+		(*ordered.Map)(&dotgen.Env).Set(pair.Key, pair.Value)
+	}
+
+	for _, pair := range other.Vars {
+		(*ordered.Map)(&dotgen.Vars).Set(pair.Key, pair.Value)
+	}
+
+	return dotgen
+}
+
+// Without returns a new Dotgen instance without the commands with the given names.
+func (a Dotgen) Without(names []string) Dotgen {
+	dotgen := a
+	dotgen.Commands = slices.DeleteFunc(slices.Clone(a.Commands), func(c Command) bool {
+		return slices.Contains(names, c.Name)
+	})
+
+	return dotgen
+}
+
+// Overlay returns a new Dotgen instance with the configuration of other laid over this one.
+// Env and vars entries of other replace same-named entries in place. The commands of other replace all
+// same-named commands at the position of the first one, and commands with new names are appended.
+// Likewise, the files of other replace all files with the same destination, and files with new destinations are appended.
+func (a Dotgen) Overlay(other Dotgen) Dotgen {
+	dotgen := a.Merge(Dotgen{Env: other.Env, Vars: other.Vars})
+	dotgen.Commands = []Command{}
+
+	replaced := map[string]bool{}
+
+	for _, c := range a.Commands {
+		indices := other.indices(c.Name)
+
+		switch {
+		case len(indices) == 0:
+			dotgen.Commands = append(dotgen.Commands, c)
+		case !replaced[c.Name]:
+			replaced[c.Name] = true
+
+			for _, i := range indices {
+				dotgen.Commands = append(dotgen.Commands, other.Commands[i])
+			}
+		}
+	}
+
+	for _, c := range other.Commands {
+		if !replaced[c.Name] {
+			dotgen.Commands = append(dotgen.Commands, c)
+		}
+	}
+
+	dotgen.Files = []File{}
+
+	placed := map[string]bool{}
+
+	for _, f := range a.Files {
+		files := other.filesAt(f.Path())
+
+		switch {
+		case len(files) == 0:
+			dotgen.Files = append(dotgen.Files, f)
+		case !placed[f.Path()]:
+			placed[f.Path()] = true
+
+			dotgen.Files = append(dotgen.Files, files...)
+		}
+	}
+
+	for _, f := range other.Files {
+		if !placed[f.Path()] {
+			dotgen.Files = append(dotgen.Files, f)
+		}
+	}
+
+	return dotgen
+}
+
+// filesAt returns the files written to the given destination.
+func (a Dotgen) filesAt(destination string) []File {
+	return slices.DeleteFunc(slices.Clone(a.Files), func(f File) bool { return f.Path() != destination })
+}
+
+// Sorted returns a new Dotgen instance with commands ordered by their "after" and "before" constraints.
+// Constraints naming commands that are not part of this configuration are ignored.
+func (a Dotgen) Sorted() (Dotgen, error) {
+	var graph order.Graph
+
+	for _, c := range a.Commands {
+		graph.Add(c.Name, 0)
+	}
+
+	for i, c := range a.Commands {
+		graph.Link(i, c.Constraints, a.indices)
+	}
+
+	indices, err := graph.Sort()
+	if err != nil {
+		return a, fmt.Errorf("ordering commands: %w", err)
+	}
+
+	dotgen := a
+	dotgen.Commands = make([]Command, 0, len(indices))
+
+	for _, i := range indices {
+		dotgen.Commands = append(dotgen.Commands, a.Commands[i])
+	}
+
+	return dotgen, nil
+}
+
+// Names returns the names of all commands, in order.
+func (a Dotgen) Names() []string {
+	names := make([]string, 0, len(a.Commands))
+	for _, c := range a.Commands {
+		names = append(names, c.Name)
+	}
+
+	return names
+}
+
+// indices returns the positions of all commands with the given name.
+func (a Dotgen) indices(name string) []int {
+	indices := []int{}
+
+	for i, c := range a.Commands {
+		if c.Name == name {
+			indices = append(indices, i)
+		}
+	}
+
+	return indices
+}
+
+// Job represents a configuration to export with ExportAll.
+type Job struct {
+	// File is the file the configuration was generated from.
+	File string
+	// Dotgen is the configuration to export.
+	Dotgen Dotgen
+	// Options controls how the commands of the configuration are exported.
+	Options Options
+}
+
+// task identifies a command of a job.
+type task struct {
+	// job is the index of the job.
+	job int
+	// command is the index of the command in the job.
+	command int
+}
+
+// errSkipped is reported for commands that are not exported because an earlier command failed.
+var errSkipped = errors.New("skipped after an earlier failure")
+
 // Export returns a string representation of the Dotgen configuration.
-func (a Dotgen) Export(shell, file string, instrument bool, parallel int) (string, error) {
+func (a Dotgen) Export(ctx context.Context, file string, options Options) (string, error) {
+	outputs, err := ExportAll(ctx, []Job{{File: file, Dotgen: a, Options: options}}, options.Parallel)
+	if err != nil {
+		return "", err
+	}
+
+	return outputs[0], nil
+}
+
+// ExportAll returns string representations of the configurations of all jobs.
+// The commands of all jobs share one pool of at most parallel concurrent exports,
+// while the outputs are assembled in job order with commands in their original order.
+// If commands fail, the error of the first failing command in that order is returned.
+func ExportAll(ctx context.Context, jobs []Job, parallel int) ([]string, error) {
+	tasks := []task{}
+
+	for i, job := range jobs {
+		for j := range job.Dotgen.Commands {
+			tasks = append(tasks, task{job: i, command: j})
+		}
+	}
+
+	exports := exportCommands(ctx, jobs, tasks, parallel)
+	outputs := make([]string, 0, len(jobs))
+	offset := 0
+
+	for _, job := range jobs {
+		count := len(job.Dotgen.Commands)
+
+		output, err := job.Dotgen.assemble(job.File, job.Options, exports[offset:offset+count])
+		if err != nil {
+			return nil, err
+		}
+
+		outputs = append(outputs, output)
+		offset += count
+	}
+
+	return outputs, nil
+}
+
+// assemble returns a string representation of the Dotgen configuration from its exported commands.
+func (a Dotgen) assemble(file string, options Options, commands []commandExport) (string, error) {
 	var buf bytes.Buffer
 
-	if len(a.Env) > 0 {
+	env, err := a.Env.Sorted()
+	if err != nil {
+		return "", err
+	}
+
+	vars, err := a.Vars.Sorted()
+	if err != nil {
+		return "", err
+	}
+
+	if len(env) > 0 {
 		buf.WriteString("\n# Environment variables\n")
 		buf.WriteString("# ------------------------------------------------\n")
-		buf.WriteString(a.Env.Export())
+		buf.WriteString(env.Export())
 		buf.WriteString("\n")
 		buf.WriteString("# ------------------------------------------------\n")
 	}
 
-	if len(a.Vars) > 0 {
+	if len(vars) > 0 {
 		buf.WriteString("\n# Variables\n")
 		buf.WriteString("# ------------------------------------------------\n")
-		buf.WriteString(a.Vars.Export())
+		buf.WriteString(vars.Export())
 		buf.WriteString("\n")
 		buf.WriteString("# ------------------------------------------------\n")
 	}
 
 	instrumentation := Instrument(file)
 
-	if !instrument {
+	if !options.Instrument {
 		instrumentation.Disable()
 	}
 
+	deferredInstrumentation := instrumentation.Deferred()
+
 	buf.WriteString(instrumentation.Header())
 
+	deferred := []commandExport{}
+
+	for _, c := range commands {
+		if c.err != nil {
+			return "", c.err
+		}
+	}
+
 	if len(a.Commands) > 0 {
 		buf.WriteString("\n# Commands\n")
 		buf.WriteString("# ------------------------------------------------\n")
 
-		commands := exportCommands(a.Commands, shell, parallel)
-
 		for _, c := range commands {
-			if c.err != nil {
-				return "", c.err
+			if c.deferred {
+				deferred = append(deferred, c)
+
+				continue
 			}
 
 			buf.WriteString(instrumentation.Wrap(c.name, c.command))
@@ -124,60 +420,91 @@ func (a Dotgen) Export(shell, file string, instrument bool, parallel int) (strin
 		buf.WriteString("# ------------------------------------------------\n")
 	}
 
+	if len(deferred) > 0 {
+		buf.WriteString("\n")
+		buf.WriteString(deferredInstrumentation.Header())
+		buf.WriteString(Defer(options.Shell, file, deferred, deferredInstrumentation))
+	}
+
 	return strings.TrimSpace(buf.String()), nil
 }
 
 // exportCommand renders one command for shell export.
-func exportCommand(command Command, shell string) commandExport {
-	output, err := command.Export(shell)
+func exportCommand(ctx context.Context, command Command, options Options) commandExport {
+	if ctx.Err() != nil {
+		return commandExport{name: command.Name, err: context.Cause(ctx)}
+	}
+
+	output, err := command.Export(ctx, options)
 
 	return commandExport{
-		name:    command.Name,
-		command: output,
-		err:     err,
+		name:     command.Name,
+		command:  output,
+		deferred: command.Defer,
+		err:      err,
 	}
 }
 
-// exportCommands renders commands with bounded concurrency while preserving output order.
-func exportCommands(commands []Command, shell string, parallel int) []commandExport {
-	if parallel < 1 {
-		parallel = 1
-	}
-
-	exports := make([]commandExport, len(commands))
-	if len(commands) == 0 {
+// exportCommands renders the commands of the tasks with bounded concurrency, returning the exports in task order.
+// Once a command fails, commands of later tasks that have not started yet are skipped, so that
+// the first failure in task order is always reported, regardless of scheduling.
+func exportCommands(ctx context.Context, jobs []Job, tasks []task, parallel int) []commandExport {
+	exports := make([]commandExport, len(tasks))
+	if len(tasks) == 0 {
 		return exports
 	}
 
-	if parallel > len(commands) {
-		parallel = len(commands)
+	parallel = min(max(parallel, 1), len(tasks))
+
+	var failed atomic.Int64
+
+	failed.Store(int64(len(tasks)))
+
+	export := func(i int) {
+		job := jobs[tasks[i].job]
+		command := job.Dotgen.Commands[tasks[i].command]
+
+		if int64(i) > failed.Load() {
+			exports[i] = commandExport{name: command.Name, err: errSkipped}
+
+			return
+		}
+
+		exports[i] = exportCommand(ctx, command, job.Options)
+
+		for exports[i].err != nil {
+			lowest := failed.Load()
+			if int64(i) >= lowest || failed.CompareAndSwap(lowest, int64(i)) {
+				break
+			}
+		}
 	}
 
 	if parallel == 1 {
-		for i, command := range commands {
-			exports[i] = exportCommand(command, shell)
+		for i := range tasks {
+			export(i)
 		}
 
 		return exports
 	}
 
-	jobs := make(chan int)
+	indices := make(chan int)
 
 	var waitGroup sync.WaitGroup
 
 	for range parallel {
 		waitGroup.Go(func() {
-			for i := range jobs {
-				exports[i] = exportCommand(commands[i], shell)
+			for i := range indices {
+				export(i)
 			}
 		})
 	}
 
-	for i := range commands {
-		jobs <- i
+	for i := range tasks {
+		indices <- i
 	}
 
-	close(jobs)
+	close(indices)
 	waitGroup.Wait()
 
 	return exports
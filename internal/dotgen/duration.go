@@ -0,0 +1,45 @@
+package dotgen
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// days matches day and week components of a duration, such as "7d" or "1.5w".
+var days = regexp.MustCompile(`(\d+(?:\.\d+)?)([dw])`)
+
+// parseDuration parses a Go duration string, extended with days ("d") and weeks ("w"), such as "7d" or "1w2d12h".
+func parseDuration(s string) (time.Duration, error) {
+	var err error
+
+	converted := days.ReplaceAllStringFunc(s, func(component string) string {
+		match := days.FindStringSubmatch(component)
+
+		value, parseErr := strconv.ParseFloat(match[1], 64)
+		if parseErr != nil {
+			err = parseErr
+
+			return component
+		}
+
+		hours := value * 24
+		if match[2] == "w" {
+			hours *= 7
+		}
+
+		return strconv.FormatFloat(hours, 'f', -1, 64) + "h"
+	})
+
+	if err != nil {
+		return 0, fmt.Errorf("time: invalid duration %q", s)
+	}
+
+	duration, err := time.ParseDuration(converted)
+	if err != nil {
+		return 0, fmt.Errorf("time: invalid duration %q", s)
+	}
+
+	return duration, nil
+}
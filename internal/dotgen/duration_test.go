@@ -0,0 +1,48 @@
+package dotgen
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		input string
+		want  time.Duration
+	}{
+		{input: "30s", want: 30 * time.Second},
+		{input: "1h30m", want: 90 * time.Minute},
+		{input: "1d", want: 24 * time.Hour},
+		{input: "7d", want: 7 * 24 * time.Hour},
+		{input: "1w", want: 7 * 24 * time.Hour},
+		{input: "1.5d", want: 36 * time.Hour},
+		{input: "1w2d12h", want: 9*24*time.Hour + 12*time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := parseDuration(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.want {
+				t.Errorf("parseDuration(%q) = %s, want %s", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDurationInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, input := range []string{"", "d", "1x", "1d2"} {
+		if _, err := parseDuration(input); err == nil {
+			t.Errorf("parseDuration(%q) succeeded, want an error", input)
+		}
+	}
+}
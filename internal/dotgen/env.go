@@ -1,11 +1,71 @@
 package dotgen
 
-import "github.com/idelchi/dotgen/internal/format"
+import (
+	"fmt"
+	"os"
+	"strings"
 
-// Env represents environment variables to be set.
-type Env map[string]string
+	"go.yaml.in/yaml/v4"
+
+	"github.com/idelchi/dotgen/internal/ordered"
+)
+
+// Env represents environment variables to be set, in declaration order.
+type Env ordered.Map
+
+// UnmarshalYAML decodes the environment variables, preserving their declaration order.
+func (e *Env) UnmarshalYAML(value *yaml.Node) error {
+	return (*ordered.Map)(e).UnmarshalYAML(value)
+}
+
+// Sorted returns the environment variables reordered so that references between them resolve.
+func (e Env) Sorted() (Env, error) {
+	sorted, err := ordered.Map(e).Sorted()
+	if err != nil {
+		return nil, fmt.Errorf("ordering env: %w", err)
+	}
+
+	return Env(sorted), nil
+}
 
 // Export returns a string representation of the environment variables, suitable for shell usage.
 func (e Env) Export() string {
-	return format.Map(e, "export %s=%q")
+	return ordered.Map(e).Format("export %s=%q")
+}
+
+// Environ returns the base environment, in "KEY=value" form, with the environment variables applied.
+// References to other variables are expanded against the resulting environment.
+func (e Env) Environ(base []string) ([]string, error) {
+	sorted, err := e.Sorted()
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]string{}
+	keys := []string{}
+
+	for _, entry := range base {
+		key, value, _ := strings.Cut(entry, "=")
+
+		if _, ok := values[key]; !ok {
+			keys = append(keys, key)
+		}
+
+		values[key] = value
+	}
+
+	for _, pair := range sorted {
+		if _, ok := values[pair.Key]; !ok {
+			keys = append(keys, pair.Key)
+		}
+
+		values[pair.Key] = os.Expand(pair.Value, func(name string) string { return values[name] })
+	}
+
+	environ := make([]string, 0, len(keys))
+	for _, key := range keys {
+		environ = append(environ, key+"="+values[key])
+	}
+
+	return environ, nil
 }
@@ -0,0 +1,107 @@
+package dotgen
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/idelchi/dotgen/internal/atomicfile"
+	"github.com/idelchi/dotgen/internal/exclusion"
+	"github.com/idelchi/dotgen/internal/filter"
+)
+
+// File represents a file rendered from a template and written to a destination.
+type File struct {
+	// Source is the path of the template. Relative paths resolve from the configuration file declaring it.
+	Source string `yaml:"source"`
+	// Destination is the path the rendered template is written to. Environment variables are expanded,
+	// and relative paths resolve from the configuration file declaring it.
+	Destination string `yaml:"destination"`
+	// Mode is the octal file mode of the destination, such as "0644". Defaults to "0600".
+	Mode string `yaml:"mode,omitempty"`
+	// Scope specifies the environments for which this file is applicable.
+	filter.Scope `yaml:",inline"`
+	// Exclude specifies whether to exclude this file.
+	Exclude exclusion.Exclude `yaml:"exclude,omitempty"`
+
+	// Content is the rendered template, set while loading.
+	Content string `yaml:"-"`
+}
+
+// Validate checks the file for any issues.
+func (f *File) Validate() error {
+	errs := []error{}
+
+	if strings.TrimSpace(f.Source) == "" {
+		errs = append(errs, errors.New("source is required"))
+	}
+
+	if strings.TrimSpace(f.Destination) == "" {
+		errs = append(errs, errors.New("destination is required"))
+	}
+
+	if _, err := parseMode(f.Mode); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("file %q: %w", f.Source, err)
+	}
+
+	return nil
+}
+
+// Resolve makes the source and the destination absolute, resolving relative paths from the given directory.
+// Destinations that use undefined environment variables are rejected, as they could expand to an unintended path.
+func (f *File) Resolve(dir string) error {
+	var undefined []string
+
+	os.Expand(f.Destination, func(name string) string {
+		if _, ok := os.LookupEnv(name); !ok {
+			undefined = append(undefined, name)
+		}
+
+		return ""
+	})
+
+	if len(undefined) > 0 {
+		return fmt.Errorf("file %q: destination %q uses undefined environment variables %v", f.Source, f.Destination, undefined)
+	}
+
+	if !filepath.IsAbs(f.Source) {
+		f.Source = filepath.Join(dir, f.Source)
+	}
+
+	if !filepath.IsAbs(f.Path()) {
+		f.Destination = filepath.Join(dir, f.Destination)
+	}
+
+	return nil
+}
+
+// Path returns the destination with environment variables expanded.
+func (f *File) Path() string {
+	return os.ExpandEnv(f.Destination)
+}
+
+// Write writes the rendered template to the destination, and reports whether its content changed.
+func (f *File) Write() (bool, error) {
+	mode, err := parseMode(f.Mode)
+	if err != nil {
+		return false, fmt.Errorf("file %q: %w", f.Source, err)
+	}
+
+	changed, err := atomicfile.Write(f.Path(), []byte(f.Content), mode)
+	if err != nil {
+		return false, fmt.Errorf("writing %q from %q: %w", f.Path(), f.Source, err)
+	}
+
+	return changed, nil
+}
+
+// IsExcluded checks if the file should be excluded based on its exclusion conditions and scope.
+func (f *File) IsExcluded(facts filter.Facts) bool {
+	return f.Exclude.IsExcluded() || !f.Matches(facts)
+}
@@ -32,6 +32,15 @@ func (i *Instrumentation) Disable() {
 	i.Enabled = false
 }
 
+// Deferred returns an Instrumentation for the deferred commands of the same file,
+// which records and reports their timing separately.
+func (i Instrumentation) Deferred() Instrumentation {
+	i.Name += " (deferred)"
+	i.variable += "_deferred"
+
+	return i
+}
+
 // Header returns the header section for instrumentation.
 func (i Instrumentation) Header() string {
 	if !i.Enabled {
@@ -0,0 +1,41 @@
+package dotgen
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// IntervalShells represents the shells supported by Interval, which generates POSIX shell code.
+//
+//nolint:gochecknoglobals  // This is a constant list of supported shells.
+var IntervalShells = []string{"sh", "bash", "zsh", "ksh", "dash"}
+
+// Interval wraps the code of the named command so that it runs at most once per interval when the shell starts.
+//
+// The time of the last run is kept in the stamp file and updated before the code runs,
+// so that shells starting at the same time do not run it twice.
+// With background, the code runs detached from the shell in a subshell, with its output discarded,
+// so that interactive shells neither track it as a job nor print job-control notices.
+func Interval(name, code, stamp string, every time.Duration, background bool) string {
+	variable := fmt.Sprintf("__dotgen_interval_%s", toShellVar(name))
+
+	code = strings.TrimRight(code, "\n")
+
+	if background {
+		code = fmt.Sprintf("(\n{\n%s\n} >/dev/null 2>&1 &\n)", code)
+	}
+
+	var builder strings.Builder
+
+	fmt.Fprintf(&builder, "%s_now=$(date +%%s)\n", variable)
+	fmt.Fprintf(&builder, "%s_last=$(cat %q 2>/dev/null || echo 0)\n", variable, stamp)
+	fmt.Fprintf(&builder, "if [ $((%s_now - %s_last)) -ge %d ]; then\n", variable, variable, int64(every.Seconds()))
+	fmt.Fprintf(&builder, "mkdir -p %q && echo \"$%s_now\" >%q\n", filepath.Dir(stamp), variable, stamp)
+	fmt.Fprintf(&builder, "%s\n", code)
+	fmt.Fprint(&builder, "fi\n")
+	fmt.Fprintf(&builder, "unset %s_now %s_last\n", variable, variable)
+
+	return builder.String()
+}
@@ -0,0 +1,68 @@
+package dotgen_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/idelchi/dotgen/internal/dotgen"
+)
+
+func TestInterval(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	ran := filepath.Join(dir, "ran")
+
+	snippet := dotgen.Interval("update", "echo run >>"+ran, filepath.Join(dir, "stamps", "update"), time.Hour, false)
+
+	for range 2 {
+		if output, err := exec.CommandContext(t.Context(), "sh", "-c", snippet).CombinedOutput(); err != nil {
+			t.Fatalf("running snippet: %v\n%s", err, output)
+		}
+	}
+
+	data, err := os.ReadFile(ran)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Count(string(data), "run"); got != 1 {
+		t.Errorf("code ran %d times within the interval, want 1", got)
+	}
+}
+
+func TestIntervalBackground(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	ran := filepath.Join(dir, "ran")
+
+	snippet := dotgen.Interval("update", "echo output; touch "+ran, filepath.Join(dir, "stamp"), time.Hour, true)
+
+	if strings.Contains(snippet, "disown") {
+		t.Errorf("background snippet uses disown:\n%s", snippet)
+	}
+
+	output, err := exec.CommandContext(t.Context(), "sh", "-c", snippet).CombinedOutput()
+	if err != nil {
+		t.Fatalf("running snippet: %v\n%s", err, output)
+	}
+
+	if len(output) > 0 {
+		t.Errorf("background snippet printed %q, want no output", output)
+	}
+
+	for range 50 {
+		if _, err := os.Stat(ran); err == nil {
+			return
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	t.Error("background code did not run")
+}
@@ -15,3 +15,17 @@ const (
 //
 //nolint:gochecknoglobals  // This is a constant list of supported kinds.
 var Kinds = []string{Alias, Function, Raw, Run}
+
+const (
+	// OnErrorFail aborts the generation when a "run" command fails.
+	OnErrorFail = "fail"
+	// OnErrorSkip leaves a failed "run" command out of the output.
+	OnErrorSkip = "skip"
+	// OnErrorWarn replaces the output of a failed "run" command with a warning printed when the shell loads.
+	OnErrorWarn = "warn"
+)
+
+// OnErrorPolicies represents the supported policies for failing "run" commands.
+//
+//nolint:gochecknoglobals  // This is a constant list of supported policies.
+var OnErrorPolicies = []string{OnErrorFail, OnErrorSkip, OnErrorWarn}
@@ -0,0 +1,27 @@
+package dotgen
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Lazy wraps the code of the named command in a loader function, and returns it together with a stub function
+// for each of the given names.
+// The first call to any stub removes all stubs and the loader, runs the code and re-runs the called name
+// with its arguments.
+func Lazy(name string, names []string, code string) string {
+	loader := fmt.Sprintf("__dotgen_lazy_%s", toShellVar(name))
+
+	var builder strings.Builder
+
+	fmt.Fprintf(&builder, "%s() {\n", loader)
+	fmt.Fprintf(&builder, "unset -f %s %s\n", strings.Join(names, " "), loader)
+	fmt.Fprintf(&builder, "%s\n", strings.TrimRight(code, "\n"))
+	fmt.Fprint(&builder, "}\n")
+
+	for _, stub := range names {
+		fmt.Fprintf(&builder, "%s() {\n%s\n%s \"$@\"\n}\n", stub, loader, stub)
+	}
+
+	return builder.String()
+}
@@ -0,0 +1,35 @@
+package dotgen
+
+import (
+	"errors"
+	"fmt"
+
+	"go.yaml.in/yaml/v4"
+)
+
+// Once represents the `once` setting of a "run" command, written as `true` or as a key.
+type Once struct {
+	// Enabled indicates that the command runs only once.
+	Enabled bool
+	// Key identifies the completion stamp of the command. Empty means the name of the command.
+	Key string
+}
+
+// UnmarshalYAML decodes the setting from a boolean or a key.
+func (o *Once) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode && value.Tag == "!!bool" {
+		return value.Decode(&o.Enabled) //nolint:wrapcheck // Error is already descriptive enough.
+	}
+
+	if err := value.Decode(&o.Key); err != nil {
+		return fmt.Errorf("once must be a boolean or a key: %w", err)
+	}
+
+	if o.Key == "" {
+		return errors.New("once key must not be empty")
+	}
+
+	o.Enabled = true
+
+	return nil
+}
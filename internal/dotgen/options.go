@@ -0,0 +1,30 @@
+package dotgen
+
+import "github.com/idelchi/dotgen/internal/state"
+
+// Options controls how commands are exported.
+type Options struct {
+	// Shell is the shell the commands are exported for, and that "run" commands are executed with.
+	Shell string
+	// Interpreter is the default interpreter for "run" commands. Empty means the shell.
+	Interpreter string
+	// Instrument enables instrumentation for profiling.
+	Instrument bool
+	// Parallel is how many commands may be exported at the same time.
+	Parallel int
+	// CacheDir is the directory cached outputs of "run" commands are stored in.
+	CacheDir string
+	// State holds the completion stamps of commands that run only once. Nil runs them every time.
+	State *state.State
+	// Refresh forces cached "run" commands to be executed again.
+	Refresh bool
+	// Warn prints a warning, such as when the expired cached output of a failed "run" command is used. Nil discards warnings.
+	Warn func(format string, args ...any)
+}
+
+// warn prints a warning if a handler is set.
+func (o Options) warn(format string, args ...any) {
+	if o.Warn != nil {
+		o.Warn(format, args...)
+	}
+}
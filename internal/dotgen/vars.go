@@ -1,11 +1,32 @@
 package dotgen
 
-import "github.com/idelchi/dotgen/internal/format"
+import (
+	"fmt"
 
-// Vars represents variables to be set.
-type Vars map[string]string
+	"go.yaml.in/yaml/v4"
+
+	"github.com/idelchi/dotgen/internal/ordered"
+)
+
+// Vars represents variables to be set, in declaration order.
+type Vars ordered.Map
+
+// UnmarshalYAML decodes the variables, preserving their declaration order.
+func (v *Vars) UnmarshalYAML(value *yaml.Node) error {
+	return (*ordered.Map)(v).UnmarshalYAML(value)
+}
+
+// Sorted returns the variables reordered so that references between them resolve.
+func (v Vars) Sorted() (Vars, error) {
+	sorted, err := ordered.Map(v).Sorted()
+	if err != nil {
+		return nil, fmt.Errorf("ordering vars: %w", err)
+	}
+
+	return Vars(sorted), nil
+}
 
 // Export returns a string representation of the variables, suitable for shell usage.
 func (v Vars) Export() string {
-	return format.Map(v, "%s=%q")
+	return ordered.Map(v).Format("%s=%q")
 }
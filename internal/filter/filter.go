@@ -0,0 +1,98 @@
+// Package filter provides the environment filters shared by commands and file headers.
+package filter
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/bmatcuk/doublestar/v4"
+
+	"github.com/idelchi/dotgen/internal/tags"
+)
+
+// Facts represents the current environment that filters are evaluated against.
+type Facts struct {
+	// Platforms contains the active platforms, such as the operating system, "wsl" and "docker".
+	Platforms []string
+	// Shell is the active shell.
+	Shell string
+	// Host is the hostname.
+	Host string
+	// User is the name of the current user.
+	User string
+	// Arch contains the names of the current architecture, such as "x86_64" and "amd64".
+	Arch []string
+	// Distro contains the Linux distribution and its family, such as "ubuntu" and "debian".
+	Distro []string
+	// Selection is the active tag selection.
+	Selection tags.Selection
+}
+
+// Scope represents filters restricting where a command or file applies.
+// Empty filters match everything. Entries support glob patterns, such as "build-*".
+type Scope struct {
+	// OS specifies the operating systems for which this is applicable.
+	OS []string `yaml:"os,omitempty"`
+	// Shell specifies the shells for which this is applicable.
+	Shell []string `yaml:"shell,omitempty"`
+	// Host specifies the hostnames for which this is applicable.
+	Host []string `yaml:"host,omitempty"`
+	// User specifies the users for which this is applicable.
+	User []string `yaml:"user,omitempty"`
+	// Arch specifies the architectures for which this is applicable.
+	Arch []string `yaml:"arch,omitempty"`
+	// Distro specifies the Linux distributions or distribution families for which this is applicable.
+	Distro []string `yaml:"distro,omitempty"`
+	// Tags specifies tags for selecting this with --tags.
+	Tags []string `yaml:"tags,omitempty"`
+}
+
+// Matches reports whether all filters of the scope match the facts.
+func (s Scope) Matches(facts Facts) bool {
+	return s.Mismatch(facts) == ""
+}
+
+// Mismatch returns a description of the first filter that does not match the facts,
+// or an empty string if all filters match.
+func (s Scope) Mismatch(facts Facts) string {
+	checks := []struct {
+		name     string
+		patterns []string
+		values   []string
+	}{
+		{"os", s.OS, facts.Platforms},
+		{"shell", s.Shell, []string{facts.Shell}},
+		{"host", s.Host, []string{facts.Host}},
+		{"user", s.User, []string{facts.User}},
+		{"arch", s.Arch, facts.Arch},
+		{"distro", s.Distro, facts.Distro},
+	}
+
+	for _, check := range checks {
+		if !Match(check.patterns, check.values...) {
+			return fmt.Sprintf("%s is for %v, current %s is %v", check.name, check.patterns, check.name, check.values)
+		}
+	}
+
+	if !facts.Selection.Matches(s.Tags) {
+		return fmt.Sprintf("tagged %v, not selected by the active tags", s.Tags)
+	}
+
+	return ""
+}
+
+// Match reports whether any of the values matches any of the glob patterns.
+// An empty list of patterns matches everything.
+func Match(patterns []string, values ...string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	return slices.ContainsFunc(patterns, func(pattern string) bool {
+		return slices.ContainsFunc(values, func(value string) bool {
+			matched, err := doublestar.Match(pattern, value)
+
+			return err == nil && matched
+		})
+	})
+}
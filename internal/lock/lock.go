@@ -0,0 +1,51 @@
+// Package lock serializes access to files shared by concurrent dotgen invocations.
+package lock
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Lock represents an exclusive lock held on a lock file.
+type Lock struct {
+	// file is the open lock file, or nil once the lock is released.
+	file *os.File
+}
+
+// Acquire blocks until it holds the exclusive lock of the file at path, creating the file as needed.
+func Acquire(path string) (*Lock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("creating directories for %q: %w", path, err)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o600) //nolint:gosec // Path is derived from the cache directory.
+	if err != nil {
+		return nil, fmt.Errorf("opening lock %q: %w", path, err)
+	}
+
+	if err := lock(file); err != nil {
+		file.Close() //nolint:errcheck,gosec // The locking error is more relevant.
+
+		return nil, fmt.Errorf("locking %q: %w", path, err)
+	}
+
+	return &Lock{file: file}, nil
+}
+
+// Release releases the lock. Releasing a lock more than once has no effect.
+func (l *Lock) Release() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+
+	file := l.file
+	l.file = nil
+
+	// Closing the file releases the lock.
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("releasing lock %q: %w", file.Name(), err)
+	}
+
+	return nil
+}
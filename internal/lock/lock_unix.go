@@ -0,0 +1,19 @@
+//go:build unix
+
+package lock
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// lock takes an exclusive advisory lock on the file, waiting for other holders to release it.
+func lock(file *os.File) error {
+	for {
+		err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX) //nolint:gosec // File descriptors fit in an int.
+		if !errors.Is(err, syscall.EINTR) {
+			return err //nolint:wrapcheck // Error is wrapped by the caller.
+		}
+	}
+}
@@ -0,0 +1,151 @@
+// Package manifest records the files dotgen exported, so that outputs that are no longer generated can be removed.
+package manifest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/idelchi/dotgen/internal/atomicfile"
+	"github.com/idelchi/dotgen/internal/lock"
+)
+
+// Entry represents an exported file.
+type Entry struct {
+	// Path is the path of the exported file.
+	Path string `json:"path"`
+	// Command is the name of the command that exported the file, or "files" for files rendered from templates.
+	Command string `json:"command"`
+	// Source is the configuration file declaring the command.
+	Source string `json:"source"`
+	// Profile identifies the options, such as the shell and tags, of the generation that exported the file.
+	Profile string `json:"profile,omitempty"`
+	// Stale indicates that the file is no longer exported by the current configuration.
+	Stale bool `json:"stale,omitempty"`
+}
+
+// Manifest represents the files exported by dotgen.
+type Manifest struct {
+	// Entries contains the exported files, sorted by path.
+	Entries []Entry `json:"entries"`
+
+	// path is the path the manifest is stored at.
+	path string
+	// lock is held from loading the manifest until it is closed.
+	lock *lock.Lock
+}
+
+// Load locks and reads the manifest stored at path. A missing manifest is empty.
+// The lock is held until Close, so that concurrent invocations do not overwrite each other's entries.
+func Load(path string) (Manifest, error) {
+	held, err := lock.Acquire(path + ".lock")
+	if err != nil {
+		return Manifest{}, err //nolint:wrapcheck // Error is already descriptive enough.
+	}
+
+	manifest := Manifest{path: path, lock: held}
+
+	data, err := os.ReadFile(path) //nolint:gosec // Path is derived from the cache directory.
+	if errors.Is(err, fs.ErrNotExist) {
+		return manifest, nil
+	}
+
+	if err == nil {
+		err = json.Unmarshal(data, &manifest)
+	}
+
+	if err != nil {
+		return manifest, errors.Join(fmt.Errorf("reading manifest %q: %w", path, err), manifest.Close())
+	}
+
+	return manifest, nil
+}
+
+// Close releases the lock taken by Load.
+func (m Manifest) Close() error {
+	return m.lock.Release() //nolint:wrapcheck // Error is already descriptive enough.
+}
+
+// Save stores the manifest at the path it was loaded from.
+func (m Manifest) Save() error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding manifest: %w", err)
+	}
+
+	if _, err := atomicfile.Write(m.path, append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("saving manifest: %w", err)
+	}
+
+	return nil
+}
+
+// Update records the files exported by a generation of the profile that processed the given configuration files.
+//
+// Previous entries of the same profile from processed configuration files that were not exported again,
+// and entries from deleted configuration files, are marked stale.
+// Entries of other profiles or from other configuration files are kept as they are,
+// as they may still be exported by generations with different options.
+func (m *Manifest) Update(profile string, processed []string, exported []Entry) {
+	paths := map[string]bool{}
+
+	for _, entry := range exported {
+		paths[entry.Path] = true
+	}
+
+	entries := make([]Entry, 0, len(exported)+len(m.Entries))
+
+	for _, entry := range exported {
+		entry.Profile = profile
+		entries = append(entries, entry)
+	}
+
+	for _, entry := range m.Entries {
+		if paths[entry.Path] {
+			continue
+		}
+
+		current := entry.Profile == profile && slices.Contains(processed, entry.Source)
+
+		if _, err := os.Stat(entry.Source); current || errors.Is(err, fs.ErrNotExist) {
+			entry.Stale = true
+		}
+
+		paths[entry.Path] = true
+		entries = append(entries, entry)
+	}
+
+	slices.SortFunc(entries, func(a, b Entry) int { return strings.Compare(a.Path, b.Path) })
+
+	m.Entries = entries
+}
+
+// Stale returns the stale entries.
+func (m Manifest) Stale() []Entry {
+	return slices.DeleteFunc(slices.Clone(m.Entries), func(entry Entry) bool { return !entry.Stale })
+}
+
+// Remove deletes the files of the given entries and drops them from the manifest.
+// Files that no longer exist are dropped without error.
+func (m *Manifest) Remove(entries []Entry) error {
+	errs := []error{}
+	removed := map[string]bool{}
+
+	for _, entry := range entries {
+		if err := os.Remove(entry.Path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, fmt.Errorf("removing %q: %w", entry.Path, err))
+
+			continue
+		}
+
+		removed[entry.Path] = true
+	}
+
+	m.Entries = slices.DeleteFunc(slices.Clone(m.Entries), func(entry Entry) bool { return removed[entry.Path] })
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,210 @@
+// Package order provides deterministic topological ordering of named items.
+package order
+
+import (
+	"container/heap"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Constraints represents ordering constraints relative to other named items.
+type Constraints struct {
+	// After lists the names of items that must come before this one.
+	After []string `yaml:"after,omitempty"`
+	// Before lists the names of items that must come after this one.
+	Before []string `yaml:"before,omitempty"`
+}
+
+// Graph represents items and the "comes before" edges between them.
+type Graph struct {
+	names      []string
+	priorities []int
+	edges      [][]int
+	reasons    map[[2]int][]string
+}
+
+// Add adds an item with the given name and priority and returns its index.
+// Items without constraints between them are ordered by priority (lower first), then by insertion order.
+func (g *Graph) Add(name string, priority int) int {
+	g.names = append(g.names, name)
+	g.priorities = append(g.priorities, priority)
+	g.edges = append(g.edges, nil)
+
+	return len(g.names) - 1
+}
+
+// Edge records that the item at index first must come before the item at index then.
+// Self-edges and repeated edges are ignored.
+func (g *Graph) Edge(first, then int) {
+	if first == then || slices.Contains(g.edges[first], then) {
+		return
+	}
+
+	g.edges[first] = append(g.edges[first], then)
+}
+
+// Explain records why the item at index first must come before the item at index then.
+// Reasons are reported for the edges that form a cycle.
+func (g *Graph) Explain(first, then int, reason string) {
+	if g.reasons == nil {
+		g.reasons = map[[2]int][]string{}
+	}
+
+	edge := [2]int{first, then}
+
+	if !slices.Contains(g.reasons[edge], reason) {
+		g.reasons[edge] = append(g.reasons[edge], reason)
+	}
+}
+
+// Link adds the edges described by the constraints of the item at index,
+// resolving names through lookup. Names that cannot be resolved are ignored.
+func (g *Graph) Link(index int, constraints Constraints, lookup func(name string) []int) {
+	for _, name := range constraints.After {
+		for _, other := range lookup(name) {
+			g.Edge(other, index)
+		}
+	}
+
+	for _, name := range constraints.Before {
+		for _, other := range lookup(name) {
+			g.Edge(index, other)
+		}
+	}
+}
+
+// Sort returns the item indices in an order satisfying all edges.
+// It returns an error naming the full chain of items if the edges form a cycle,
+// together with the reasons recorded for its edges.
+func (g *Graph) Sort() ([]int, error) {
+	incoming := make([]int, len(g.names))
+
+	for _, targets := range g.edges {
+		for _, target := range targets {
+			incoming[target]++
+		}
+	}
+
+	ready := &queue{priorities: g.priorities}
+
+	for i, count := range incoming {
+		if count == 0 {
+			heap.Push(ready, i)
+		}
+	}
+
+	sorted := make([]int, 0, len(g.names))
+
+	for ready.Len() > 0 {
+		current := heap.Pop(ready).(int) //nolint:forcetypeassert	// The queue only holds indices.
+		sorted = append(sorted, current)
+
+		for _, target := range g.edges[current] {
+			incoming[target]--
+			if incoming[target] == 0 {
+				heap.Push(ready, target)
+			}
+		}
+	}
+
+	if len(sorted) < len(g.names) {
+		cycle := g.cycle(incoming)
+		names := make([]string, 0, len(cycle))
+		reasons := []string{}
+
+		for i, index := range cycle {
+			names = append(names, g.names[index])
+
+			if i > 0 {
+				reasons = append(reasons, g.reasons[[2]int{cycle[i-1], index}]...)
+			}
+		}
+
+		if len(reasons) > 0 {
+			return nil, fmt.Errorf(
+				"ordering cycle: %s (%s)",
+				strings.Join(names, " -> "),
+				strings.Join(reasons, "; "),
+			)
+		}
+
+		return nil, fmt.Errorf("ordering cycle: %s", strings.Join(names, " -> "))
+	}
+
+	return sorted, nil
+}
+
+// cycle returns the indices along one cycle among the items that could not be sorted,
+// starting and ending with the same item.
+func (g *Graph) cycle(incoming []int) []int {
+	predecessors := make([][]int, len(g.names))
+
+	for first, targets := range g.edges {
+		for _, target := range targets {
+			predecessors[target] = append(predecessors[target], first)
+		}
+	}
+
+	position := make(map[int]int)
+	path := []int{}
+
+	// Every unsorted item still has an unsorted predecessor,
+	// so walking backwards through them must eventually revisit an item.
+	current := slices.IndexFunc(incoming, func(count int) bool { return count > 0 })
+
+	for {
+		if start, ok := position[current]; ok {
+			cycle := []int{current}
+			for i := len(path) - 1; i >= start; i-- {
+				cycle = append(cycle, path[i])
+			}
+
+			return cycle
+		}
+
+		position[current] = len(path)
+		path = append(path, current)
+
+		for _, first := range predecessors[current] {
+			if incoming[first] > 0 {
+				current = first
+
+				break
+			}
+		}
+	}
+}
+
+// queue is a min-heap of item indices, ordered by priority and then by index.
+type queue struct {
+	priorities []int
+	items      []int
+}
+
+// Len returns the number of queued indices.
+func (q *queue) Len() int { return len(q.items) }
+
+// Less reports whether the index at i should be dequeued before the index at j.
+func (q *queue) Less(i, j int) bool {
+	a, b := q.items[i], q.items[j]
+	if q.priorities[a] != q.priorities[b] {
+		return q.priorities[a] < q.priorities[b]
+	}
+
+	return a < b
+}
+
+// Swap swaps the indices at i and j.
+func (q *queue) Swap(i, j int) { q.items[i], q.items[j] = q.items[j], q.items[i] }
+
+// Push adds an index to the queue.
+func (q *queue) Push(x any) { q.items = append(q.items, x.(int)) } //nolint:forcetypeassert	// Only indices are pushed.
+
+// Pop removes and returns the last index of the queue.
+func (q *queue) Pop() any {
+	last := q.items[len(q.items)-1]
+	q.items = q.items[:len(q.items)-1]
+
+	return last
+}
@@ -0,0 +1,87 @@
+package order_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/idelchi/dotgen/internal/order"
+)
+
+func TestSortPriority(t *testing.T) {
+	t.Parallel()
+
+	var graph order.Graph
+
+	a := graph.Add("a", 0)
+	b := graph.Add("b", -1)
+	c := graph.Add("c", 0)
+	d := graph.Add("d", 1)
+
+	graph.Edge(d, a)
+
+	got, err := graph.Sort()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Ready items are ordered by priority, then by insertion order,
+	// and an item only becomes ready once the items before it are sorted.
+	if want := []int{b, c, d, a}; !slices.Equal(got, want) {
+		t.Errorf("Sort() = %v, want %v", got, want)
+	}
+}
+
+func TestSortLink(t *testing.T) {
+	t.Parallel()
+
+	var graph order.Graph
+
+	names := map[string][]int{}
+
+	for _, name := range []string{"a", "b", "c"} {
+		names[name] = append(names[name], graph.Add(name, 0))
+	}
+
+	lookup := func(name string) []int { return names[name] }
+
+	graph.Link(names["a"][0], order.Constraints{After: []string{"c", "missing"}}, lookup)
+	graph.Link(names["b"][0], order.Constraints{Before: []string{"c"}}, lookup)
+
+	got, err := graph.Sort()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []int{1, 2, 0}; !slices.Equal(got, want) {
+		t.Errorf("Sort() = %v, want %v", got, want)
+	}
+}
+
+func TestSortCycle(t *testing.T) {
+	t.Parallel()
+
+	var graph order.Graph
+
+	a := graph.Add("a", 0)
+	b := graph.Add("b", 0)
+	c := graph.Add("c", 0)
+	d := graph.Add("d", 0)
+
+	graph.Edge(d, a)
+	graph.Edge(a, b)
+	graph.Explain(a, b, "b is after a")
+	graph.Edge(b, c)
+	graph.Explain(b, c, "c is after b")
+	graph.Edge(c, a)
+	graph.Explain(c, a, "a is after c")
+
+	_, err := graph.Sort()
+	if err == nil {
+		t.Fatal("Sort() succeeded, want a cycle error")
+	}
+
+	want := "ordering cycle: a -> b -> c -> a (b is after a; c is after b; a is after c)"
+	if got := err.Error(); got != want {
+		t.Errorf("Sort() error = %q, want %q", got, want)
+	}
+}
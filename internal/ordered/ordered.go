@@ -0,0 +1,194 @@
+// Package ordered provides string maps that keep their YAML declaration order.
+package ordered
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"go.yaml.in/yaml/v4"
+)
+
+// reference matches `$NAME` and `${NAME...}` shell variable references.
+var reference = regexp.MustCompile(`\$(?:\{([A-Za-z_][A-Za-z0-9_]*)|([A-Za-z_][A-Za-z0-9_]*))`)
+
+// Pair represents a single key-value entry.
+type Pair struct {
+	// Key is the name of the entry.
+	Key string
+	// Value is the value of the entry.
+	Value string
+}
+
+// Map represents key-value pairs in declaration order.
+type Map []Pair
+
+// FromMap converts a Go map into a Map, sorted alphabetically by key.
+func FromMap(data map[string]string) Map {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	m := make(Map, 0, len(keys))
+	for _, key := range keys {
+		m = append(m, Pair{Key: key, Value: data[key]})
+	}
+
+	return m
+}
+
+// UnmarshalYAML decodes a YAML mapping, preserving the order in which keys are declared.
+func (m *Map) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: expected a mapping of names to values", value.Line)
+	}
+
+	pairs := make(Map, 0, len(value.Content)/2) //nolint:mnd	// Mapping nodes alternate between keys and values.
+
+	for i := 0; i+1 < len(value.Content); i += 2 {
+		var key, val string
+
+		if err := value.Content[i].Decode(&key); err != nil {
+			return err //nolint:wrapcheck // Error is already descriptive enough.
+		}
+
+		if err := value.Content[i+1].Decode(&val); err != nil {
+			return err //nolint:wrapcheck // Error is already descriptive enough.
+		}
+
+		if _, ok := pairs.Get(key); ok {
+			return fmt.Errorf("line %d: duplicate key %q", value.Content[i].Line, key)
+		}
+
+		pairs = append(pairs, Pair{Key: key, Value: val})
+	}
+
+	*m = pairs
+
+	return nil
+}
+
+// Get returns the value for the given key and whether it was found.
+func (m Map) Get(key string) (string, bool) {
+	for _, pair := range m {
+		if pair.Key == key {
+			return pair.Value, true
+		}
+	}
+
+	return "", false
+}
+
+// Set replaces the value of an existing key in place, or appends a new entry.
+func (m *Map) Set(key, value string) {
+	for i, pair := range *m {
+		if pair.Key == key {
+			(*m)[i].Value = value
+
+			return
+		}
+	}
+
+	*m = append(*m, Pair{Key: key, Value: value})
+}
+
+// Format formats each entry with the given format string (like "export %s=%q")
+// and returns the entries joined by newlines, in order.
+func (m Map) Format(format string) string {
+	out := make([]string, 0, len(m))
+	for _, pair := range m {
+		out = append(out, fmt.Sprintf(format, pair.Key, pair.Value))
+	}
+
+	return strings.Join(out, "\n")
+}
+
+// Sorted returns the entries reordered so that every entry comes after the entries it references
+// through `$NAME` or `${NAME}`. Declaration order is kept wherever references allow it.
+// A self-reference (such as `PATH: "/bin:${PATH}"`) refers to the outer environment and is ignored.
+// It returns an error naming the full chain if the references form a cycle.
+func (m Map) Sorted() (Map, error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	index := make(map[string]int, len(m))
+	for i, pair := range m {
+		index[pair.Key] = i
+	}
+
+	state := make([]int, len(m))
+	sorted := make(Map, 0, len(m))
+	stack := []string{}
+
+	var visit func(i int) error
+
+	visit = func(i int) error {
+		switch state[i] {
+		case visited:
+			return nil
+		case visiting:
+			start := 0
+
+			for j, key := range stack {
+				if key == m[i].Key {
+					start = j
+				}
+			}
+
+			chain := append(stack[start:], m[i].Key) //nolint:gocritic	// The stack is not reused after a cycle.
+
+			return fmt.Errorf("reference cycle: %s", strings.Join(chain, " -> "))
+		}
+
+		state[i] = visiting
+		stack = append(stack, m[i].Key)
+
+		for _, name := range References(m[i].Value) {
+			j, ok := index[name]
+			if !ok || j == i {
+				continue
+			}
+
+			if err := visit(j); err != nil {
+				return err
+			}
+		}
+
+		stack = stack[:len(stack)-1]
+		state[i] = visited
+		sorted = append(sorted, m[i])
+
+		return nil
+	}
+
+	for i := range m {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+
+	return sorted, nil
+}
+
+// References returns the names of the shell variables referenced in the value, in order of appearance.
+func References(value string) []string {
+	names := []string{}
+
+	for _, match := range reference.FindAllStringSubmatch(value, -1) {
+		name := match[1]
+		if name == "" {
+			name = match[2]
+		}
+
+		names = append(names, name)
+	}
+
+	return names
+}
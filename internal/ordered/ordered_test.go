@@ -0,0 +1,77 @@
+package ordered_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/idelchi/dotgen/internal/ordered"
+)
+
+func TestSorted(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		m    ordered.Map
+		want []string
+	}{
+		{
+			name: "declaration order",
+			m:    ordered.Map{{Key: "B", Value: "1"}, {Key: "A", Value: "2"}},
+			want: []string{"B", "A"},
+		},
+		{
+			name: "reference moves dependency first",
+			m: ordered.Map{
+				{Key: "BIN", Value: "${ROOT}/bin"},
+				{Key: "OTHER", Value: "x"},
+				{Key: "ROOT", Value: "$HOME/.local"},
+			},
+			want: []string{"ROOT", "BIN", "OTHER"},
+		},
+		{
+			name: "self-reference",
+			m:    ordered.Map{{Key: "PATH", Value: "${BIN}:${PATH}"}, {Key: "BIN", Value: "/opt/bin"}},
+			want: []string{"BIN", "PATH"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			sorted, err := tt.m.Sorted()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := make([]string, 0, len(sorted))
+			for _, pair := range sorted {
+				got = append(got, pair.Key)
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Sorted() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSortedCycle(t *testing.T) {
+	t.Parallel()
+
+	m := ordered.Map{
+		{Key: "A", Value: "$B"},
+		{Key: "B", Value: "${C}"},
+		{Key: "C", Value: "$A"},
+	}
+
+	_, err := m.Sorted()
+	if err == nil {
+		t.Fatal("Sorted() succeeded, want a cycle error")
+	}
+
+	if want := "reference cycle: A -> B -> C -> A"; err.Error() != want {
+		t.Errorf("Sorted() error = %q, want %q", err, want)
+	}
+}
@@ -0,0 +1,125 @@
+// Package state persists completion stamps of commands that run only once.
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/idelchi/dotgen/internal/atomicfile"
+	"github.com/idelchi/dotgen/internal/lock"
+)
+
+// Stamp records the successful execution of a command.
+type Stamp struct {
+	// Hash identifies the command text that was executed.
+	Hash string `json:"hash"`
+	// Time is when the command was executed.
+	Time time.Time `json:"time"`
+}
+
+// State represents the stamps of commands that run only once, keyed by their once key.
+// It is safe for concurrent use.
+type State struct {
+	// Stamps contains the stamps by key.
+	Stamps map[string]Stamp `json:"stamps"`
+
+	// path is the path the state is stored at.
+	path string
+	// lock is held from loading the state until it is closed.
+	lock *lock.Lock
+	// mutex guards Stamps.
+	mutex sync.Mutex
+}
+
+// Load locks and reads the state stored at path. A missing state is empty.
+// The lock is held until Close, so that concurrent invocations do not run the same commands or lose stamps.
+func Load(path string) (*State, error) {
+	held, err := lock.Acquire(path + ".lock")
+	if err != nil {
+		return nil, err //nolint:wrapcheck // Error is already descriptive enough.
+	}
+
+	state := &State{Stamps: map[string]Stamp{}, path: path, lock: held}
+
+	data, err := os.ReadFile(path) //nolint:gosec // Path is derived from the cache directory.
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	}
+
+	if err == nil {
+		err = json.Unmarshal(data, state)
+	}
+
+	if err != nil {
+		return state, errors.Join(fmt.Errorf("reading state %q: %w", path, err), state.Close())
+	}
+
+	if state.Stamps == nil {
+		state.Stamps = map[string]Stamp{}
+	}
+
+	return state, nil
+}
+
+// Close releases the lock taken by Load.
+func (s *State) Close() error {
+	return s.lock.Release() //nolint:wrapcheck // Error is already descriptive enough.
+}
+
+// Done returns the stamp of the key, and whether it was recorded for the same hash.
+func (s *State) Done(key, hash string) (Stamp, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stamp, ok := s.Stamps[key]
+
+	return stamp, ok && stamp.Hash == hash
+}
+
+// Record stores a stamp for the key with the current time.
+func (s *State) Record(key, hash string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.Stamps[key] = Stamp{Hash: hash, Time: time.Now().UTC()}
+}
+
+// Reset removes the stamps of the keys and returns the keys that had a stamp.
+func (s *State) Reset(keys ...string) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	removed := []string{}
+
+	for _, key := range keys {
+		if _, ok := s.Stamps[key]; ok {
+			delete(s.Stamps, key)
+
+			removed = append(removed, key)
+		}
+	}
+
+	return removed
+}
+
+// Save stores the state at the path it was loaded from.
+func (s *State) Save() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding state: %w", err)
+	}
+
+	if _, err := atomicfile.Write(s.path, append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("saving state: %w", err)
+	}
+
+	return nil
+}
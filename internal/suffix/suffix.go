@@ -0,0 +1,221 @@
+// Package suffix parses and evaluates filename suffix conventions, such as `git_linux_zsh.dotgen`.
+//
+// The base name of a file, without its extension, is split on underscores.
+// Recognized tokens that contain an underscore themselves, such as `x86_64`, are matched before their parts.
+// Trailing parts that are recognized as a platform, Linux distribution, shell, architecture or `host-<pattern>`
+// form the suffix.
+// Parsing stops at the first unrecognized part, and the first part is never treated as a suffix.
+package suffix
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/idelchi/dotgen/internal/filter"
+)
+
+// Kinds of suffix tokens.
+const (
+	// Platform is an operating system or environment token, such as "linux" or "wsl".
+	Platform = "platform"
+	// Distro is a Linux distribution or distribution family token, such as "ubuntu" or "debian".
+	Distro = "distro"
+	// Shell is a shell token, such as "zsh".
+	Shell = "shell"
+	// Arch is an architecture token, such as "arm64".
+	Arch = "arch"
+	// Host is a hostname token, written as "host-<pattern>".
+	Host = "host"
+)
+
+// hostPrefix is the prefix of hostname tokens.
+const hostPrefix = "host-"
+
+// known maps each kind of token to its recognized values. The README lists them for users, and must be kept in sync.
+//
+//nolint:gochecknoglobals // This is a constant lookup table of recognized tokens.
+var known = map[string][]string{
+	Platform: {
+		"linux",
+		"darwin",
+		"windows",
+		"freebsd",
+		"openbsd",
+		"netbsd",
+		"dragonfly",
+		"solaris",
+		"aix",
+		"wsl",
+		"docker",
+	},
+	Distro: {
+		"ubuntu",
+		"debian",
+		"alpine",
+		"fedora",
+		"rhel",
+		"centos",
+		"rocky",
+		"almalinux",
+		"amzn",
+		"arch",
+		"manjaro",
+		"opensuse",
+		"suse",
+		"gentoo",
+		"nixos",
+		"void",
+	},
+	Shell: {
+		"bash",
+		"zsh",
+		"fish",
+		"sh",
+		"ksh",
+		"dash",
+		"pwsh",
+		"powershell",
+		"nu",
+	},
+	Arch: {
+		"amd64",
+		"x86_64",
+		"386",
+		"i386",
+		"i686",
+		"arm64",
+		"aarch64",
+		"arm",
+		"armv7l",
+		"riscv64",
+		"ppc64le",
+		"s390x",
+		"loong64",
+	},
+}
+
+// Token represents a single recognized suffix part of a file name.
+type Token struct {
+	// Kind is the kind of the token.
+	Kind string
+	// Value is the platform, distribution, shell, architecture or hostname pattern of the token.
+	Value string
+}
+
+// String returns the token as it appears in the file name.
+func (t Token) String() string {
+	if t.Kind == Host {
+		return "_" + hostPrefix + t.Value
+	}
+
+	return "_" + t.Value
+}
+
+// Mismatch returns a description of why the token does not match the facts,
+// or an empty string if it matches.
+func (t Token) Mismatch(facts filter.Facts) string {
+	var (
+		name   string
+		values []string
+	)
+
+	switch t.Kind {
+	case Platform:
+		name, values = "platforms", facts.Platforms
+	case Distro:
+		name, values = "distributions", facts.Distro
+	case Shell:
+		name, values = "shells", []string{facts.Shell}
+	case Arch:
+		name, values = "architectures", facts.Arch
+	case Host:
+		name, values = "hosts", []string{facts.Host}
+	}
+
+	if filter.Match([]string{t.Value}, values...) {
+		return ""
+	}
+
+	return fmt.Sprintf("file suffix %q: file is for %s %q, current %s are %v", t, t.Kind, t.Value, name, values)
+}
+
+// Parse returns the suffix tokens of the file name, in the order they appear.
+func Parse(file string) []Token {
+	parts := strings.Split(stem(file), "_")
+
+	tokens := []Token{}
+
+	for i := len(parts) - 1; i > 0; i-- {
+		if i > 1 {
+			if token, ok := lookup(parts[i-1] + "_" + parts[i]); ok {
+				tokens = append(tokens, token)
+				i--
+
+				continue
+			}
+		}
+
+		token, ok := parse(parts[i])
+		if !ok {
+			break
+		}
+
+		tokens = append(tokens, token)
+	}
+
+	slices.Reverse(tokens)
+
+	return tokens
+}
+
+// Mismatch returns a description of the first suffix token of the file that does not match the facts,
+// or an empty string if the file applies to the current environment.
+func Mismatch(file string, facts filter.Facts) string {
+	for _, token := range Parse(file) {
+		if mismatch := token.Mismatch(facts); mismatch != "" {
+			return mismatch
+		}
+	}
+
+	return ""
+}
+
+// Name returns the base name of the file without its extension and suffix tokens.
+func Name(file string) string {
+	name := stem(file)
+
+	for _, token := range slices.Backward(Parse(file)) {
+		name = strings.TrimSuffix(name, token.String())
+	}
+
+	return name
+}
+
+// stem returns the base name of the file without its extension.
+func stem(file string) string {
+	base := filepath.Base(file)
+
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// parse recognizes a single file name part as a suffix token.
+func parse(part string) (Token, bool) {
+	if pattern, ok := strings.CutPrefix(part, hostPrefix); ok && pattern != "" {
+		return Token{Kind: Host, Value: pattern}, true
+	}
+
+	return lookup(part)
+}
+
+// lookup recognizes a platform, distribution, shell or architecture token.
+func lookup(part string) (Token, bool) {
+	for _, kind := range []string{Platform, Distro, Shell, Arch} {
+		if slices.Contains(known[kind], part) {
+			return Token{Kind: kind, Value: part}, true
+		}
+	}
+
+	return Token{}, false
+}
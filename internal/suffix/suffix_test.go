@@ -0,0 +1,82 @@
+package suffix_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/idelchi/dotgen/internal/suffix"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		file string
+		want []suffix.Token
+		name string
+	}{
+		{
+			file: "git.dotgen",
+			want: []suffix.Token{},
+			name: "git",
+		},
+		{
+			file: "git_linux_zsh.dotgen",
+			want: []suffix.Token{{Kind: suffix.Platform, Value: "linux"}, {Kind: suffix.Shell, Value: "zsh"}},
+			name: "git",
+		},
+		{
+			file: "tools_x86_64.dotgen",
+			want: []suffix.Token{{Kind: suffix.Arch, Value: "x86_64"}},
+			name: "tools",
+		},
+		{
+			file: "tools_linux_x86_64_bash.dotgen",
+			want: []suffix.Token{
+				{Kind: suffix.Platform, Value: "linux"},
+				{Kind: suffix.Arch, Value: "x86_64"},
+				{Kind: suffix.Shell, Value: "bash"},
+			},
+			name: "tools",
+		},
+		{
+			file: "x86_64.dotgen",
+			want: []suffix.Token{},
+			name: "x86_64",
+		},
+		{
+			file: "linux_zsh.dotgen",
+			want: []suffix.Token{{Kind: suffix.Shell, Value: "zsh"}},
+			name: "linux",
+		},
+		{
+			file: "work_host-laptop*_darwin.dotgen",
+			want: []suffix.Token{{Kind: suffix.Host, Value: "laptop*"}, {Kind: suffix.Platform, Value: "darwin"}},
+			name: "work",
+		},
+		{
+			file: "my_tools_zsh.dotgen",
+			want: []suffix.Token{{Kind: suffix.Shell, Value: "zsh"}},
+			name: "my_tools",
+		},
+		{
+			file: "tools_zsh_custom.dotgen",
+			want: []suffix.Token{},
+			name: "tools_zsh_custom",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			t.Parallel()
+
+			if got := suffix.Parse(tt.file); !slices.Equal(got, tt.want) {
+				t.Errorf("Parse(%q) = %v, want %v", tt.file, got, tt.want)
+			}
+
+			if got := suffix.Name(tt.file); got != tt.name {
+				t.Errorf("Name(%q) = %q, want %q", tt.file, got, tt.name)
+			}
+		})
+	}
+}
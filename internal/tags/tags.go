@@ -0,0 +1,63 @@
+// Package tags provides tag selection expressions for commands and files.
+package tags
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Selection represents a parsed tag selection such as `work,!gui`.
+type Selection struct {
+	// Include contains the tags that select items.
+	Include []string
+	// Exclude contains the tags that deselect items.
+	Exclude []string
+}
+
+// Parse parses selection terms into a Selection.
+// Each term is a tag, optionally prefixed with `!` to exclude it, and may itself be a comma-separated list.
+func Parse(terms []string) (Selection, error) {
+	selection := Selection{Include: []string{}, Exclude: []string{}}
+
+	for _, term := range terms {
+		for tag := range strings.SplitSeq(term, ",") {
+			tag = strings.TrimSpace(tag)
+
+			negated := strings.HasPrefix(tag, "!")
+			tag = strings.TrimSpace(strings.TrimPrefix(tag, "!"))
+
+			if tag == "" {
+				return Selection{}, fmt.Errorf("invalid tag selection %q: empty tag", term)
+			}
+
+			if negated {
+				selection.Exclude = append(selection.Exclude, tag)
+			} else {
+				selection.Include = append(selection.Include, tag)
+			}
+		}
+	}
+
+	return selection, nil
+}
+
+// Matches reports whether an item with the given tags is selected.
+//
+// Untagged items are always selected. Tagged items are deselected if any of their tags is excluded,
+// and, when the selection includes tags, are only selected if at least one of their tags is included.
+func (s Selection) Matches(tags []string) bool {
+	if len(tags) == 0 {
+		return true
+	}
+
+	if slices.ContainsFunc(tags, func(tag string) bool { return slices.Contains(s.Exclude, tag) }) {
+		return false
+	}
+
+	if len(s.Include) == 0 {
+		return true
+	}
+
+	return slices.ContainsFunc(tags, func(tag string) bool { return slices.Contains(s.Include, tag) })
+}
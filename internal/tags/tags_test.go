@@ -0,0 +1,70 @@
+package tags_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/idelchi/dotgen/internal/tags"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	got, err := tags.Parse([]string{"work, !gui", "home", "! laptop"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"work", "home"}; !slices.Equal(got.Include, want) {
+		t.Errorf("Include = %v, want %v", got.Include, want)
+	}
+
+	if want := []string{"gui", "laptop"}; !slices.Equal(got.Exclude, want) {
+		t.Errorf("Exclude = %v, want %v", got.Exclude, want)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, term := range []string{"", "work,", "!", "work,,home"} {
+		if _, err := tags.Parse([]string{term}); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", term)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		terms []string
+		tags  []string
+		want  bool
+	}{
+		{name: "untagged without selection", tags: nil, want: true},
+		{name: "tagged without selection", tags: []string{"gui"}, want: true},
+		{name: "untagged with selection", terms: []string{"work,!gui"}, tags: nil, want: true},
+		{name: "included", terms: []string{"work"}, tags: []string{"work", "gui"}, want: true},
+		{name: "not included", terms: []string{"work"}, tags: []string{"home"}, want: false},
+		{name: "excluded", terms: []string{"!gui"}, tags: []string{"gui"}, want: false},
+		{name: "not excluded", terms: []string{"!gui"}, tags: []string{"cli"}, want: true},
+		{name: "exclusion wins", terms: []string{"work,!gui"}, tags: []string{"work", "gui"}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			selection, err := tags.Parse(tt.terms)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := selection.Matches(tt.tags); got != tt.want {
+				t.Errorf("Matches(%v) with %v = %t, want %t", tt.tags, tt.terms, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package variables
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Distro represents a Linux distribution.
+type Distro struct {
+	// ID is the distribution identifier, such as "ubuntu" or "alpine".
+	ID string
+	// Version is the distribution version, such as "24.04".
+	Version string
+	// Family is the distribution family, such as "debian" for Ubuntu.
+	Family string
+}
+
+// families lists distribution identifiers that are used as family names, in order of preference.
+//
+//nolint:gochecknoglobals // This is a constant list of known families.
+var families = []string{"debian", "rhel", "fedora", "arch", "alpine", "suse", "gentoo", "nixos", "void"}
+
+// DetectDistro returns the Linux distribution dotgen is running on.
+//
+// It reads os-release(5) from /etc/os-release or /usr/lib/os-release.
+// Minimal container images without os-release are recognized by their release marker files.
+// It returns an empty Distro on other operating systems or if the distribution cannot be determined.
+func DetectDistro() Distro {
+	if runtime.GOOS != "linux" {
+		return Distro{}
+	}
+
+	for _, path := range []string{"/etc/os-release", "/usr/lib/os-release"} {
+		data, err := os.ReadFile(path) //nolint:gosec // Path is selected from a hardcoded list.
+		if err != nil {
+			continue
+		}
+
+		if distro := parseOSRelease(data); distro.ID != "" {
+			return distro
+		}
+	}
+
+	for _, marker := range []struct {
+		path string
+		id   string
+		// versioned indicates that the marker file contains only the version.
+		versioned bool
+	}{
+		{"/etc/alpine-release", "alpine", true},
+		{"/etc/debian_version", "debian", true},
+		{"/etc/fedora-release", "fedora", false},
+		{"/etc/redhat-release", "rhel", false},
+		{"/etc/arch-release", "arch", false},
+	} {
+		data, err := os.ReadFile(marker.path) //nolint:gosec // Path is selected from a hardcoded list.
+		if err != nil {
+			continue
+		}
+
+		distro := Distro{ID: marker.id, Family: marker.id}
+
+		if fields := strings.Fields(string(data)); marker.versioned && len(fields) > 0 {
+			distro.Version = fields[0]
+		}
+
+		return distro
+	}
+
+	return Distro{}
+}
+
+// parseOSRelease parses the contents of an os-release file.
+func parseOSRelease(data []byte) Distro {
+	fields := map[string]string{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else {
+			value = strings.Trim(value, `'"`)
+		}
+
+		fields[key] = value
+	}
+
+	id := strings.ToLower(fields["ID"])
+	like := strings.Fields(strings.ToLower(fields["ID_LIKE"]))
+
+	return Distro{
+		ID:      id,
+		Version: fields["VERSION_ID"],
+		Family:  family(id, like),
+	}
+}
+
+// family returns the family of a distribution from its identifier and the identifiers it is like.
+// Known family names are preferred, otherwise the last "like" identifier or the identifier itself is used.
+func family(id string, like []string) string {
+	candidates := append([]string{id}, like...)
+
+	for _, known := range families {
+		if slices.Contains(candidates, known) {
+			return known
+		}
+	}
+
+	if len(like) > 0 {
+		return like[len(like)-1]
+	}
+
+	return id
+}
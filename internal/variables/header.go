@@ -8,6 +8,8 @@ import (
 
 	"github.com/idelchi/dotgen/internal/dependency"
 	"github.com/idelchi/dotgen/internal/exclusion"
+	"github.com/idelchi/dotgen/internal/filter"
+	"github.com/idelchi/dotgen/internal/order"
 
 	"go.yaml.in/yaml/v4"
 )
@@ -18,8 +20,22 @@ type Header struct {
 	Values Variables `yaml:"values,omitempty"`
 	// Dependencies contains external inputs that contribute to the generated hash.
 	Dependencies dependency.Dependencies `yaml:"dependencies,omitempty"`
+	// Include contains paths or glob patterns of files to compose into this file,
+	// relative to the directory of this file.
+	Include []string `yaml:"include,omitempty"`
+	// Templates contains paths or glob patterns of template library files for this file,
+	// relative to the directory of this file.
+	Templates []string `yaml:"templates,omitempty"`
+	// Scope restricts the environments in which this file is processed.
+	filter.Scope `yaml:",inline"`
+	// Disable contains names of commands to remove from files of lower layers.
+	Disable []string `yaml:"disable,omitempty"`
 	// Exclude indicates whether this file should be excluded from processing.
 	Exclude exclusion.Exclude `yaml:"exclude,omitempty"`
+	// Order lists the files that this file must come after or before.
+	Order order.Constraints `yaml:"order,omitempty"`
+	// Priority orders files without ordering constraints between them, lower first.
+	Priority int `yaml:"priority,omitempty"`
 }
 
 // NewHeader parses the header from the given data.
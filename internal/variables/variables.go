@@ -69,6 +69,12 @@ func Defaults(shell, file string) Variables {
 		variables["ARCHITECTURE"] = info.KernelArch
 	}
 
+	distro := DetectDistro()
+
+	variables["DISTRO"] = distro.ID
+	variables["DISTRO_VERSION"] = distro.Version
+	variables["DISTRO_FAMILY"] = distro.Family
+
 	variables["USER"] = os.Getenv("USER")
 	variables["HOME"] = filepath.ToSlash(os.Getenv("HOME"))
 
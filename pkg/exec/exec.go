@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"os/exec"
 	"strings"
 	"time"
@@ -20,33 +21,77 @@ type Result struct {
 	ExitCode int
 	// Err is any error that occurred during command execution.
 	Err error
+	// TimedOut indicates that the command was stopped because it exceeded its timeout.
+	TimedOut bool
 }
 
-// Run executes the given shell command snippet using the specified shell.
-func Run(shell, snippet string, timeout time.Duration) *Result {
-	if strings.TrimSpace(shell) == "" {
+// grace is how long a command and its descendants get to exit after SIGTERM, before they are killed.
+const grace = 2 * time.Second
+
+// Options represents optional settings for executing a shell command.
+type Options struct {
+	// Dir is the working directory of the command. Empty means the current directory.
+	Dir string
+	// Env is the environment of the command, in "KEY=value" form. Nil means the environment of the current process.
+	Env []string
+	// Stdin is the standard input of the command.
+	Stdin string
+}
+
+// Run executes the given command snippet using the specified interpreter, see Invocation.
+// The command is stopped when ctx is cancelled or the timeout expires.
+func Run(parent context.Context, interpreter, snippet string, timeout time.Duration, options Options) *Result {
+	if strings.TrimSpace(interpreter) == "" {
 		return &Result{
 			ExitCode: -1,
 			Err:      errors.New("active shell is required"),
 		}
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	args, fromStdin, err := Invocation(interpreter, snippet)
+	if err != nil {
+		return &Result{
+			ExitCode: -1,
+			Err:      err,
+		}
+	}
+
+	if fromStdin && options.Stdin != "" {
+		return &Result{
+			ExitCode: -1,
+			Err:      fmt.Errorf("interpreter %q reads the script from stdin, which cannot be combined with stdin", interpreter),
+		}
+	}
+
+	if fromStdin {
+		options.Stdin = snippet
+	}
+
+	ctx, cancel := context.WithTimeout(parent, timeout)
 	defer cancel()
 
-	cmd := exec.CommandContext( //nolint:gosec // Shell and snippet are user-authored dotgen config.
+	cmd := exec.CommandContext( //nolint:gosec // Interpreter and snippet are user-authored dotgen config.
 		ctx,
-		shell,
-		"-c",
-		snippet,
+		args[0],
+		args[1:]...,
 	)
 
+	stop := setProcessGroup(cmd, grace)
+
+	cmd.WaitDelay = grace
+
+	cmd.Dir = options.Dir
+	cmd.Env = options.Env
+	cmd.Stdin = strings.NewReader(options.Stdin)
+
 	var outBuf, errBuf bytes.Buffer
 
 	cmd.Stdout = &outBuf
 	cmd.Stderr = &errBuf
 
-	err := cmd.Run()
+	err = cmd.Run()
+
+	stop()
 
 	exitCode := -1
 
@@ -54,10 +99,22 @@ func Run(shell, snippet string, timeout time.Duration) *Result {
 		exitCode = ps.ExitCode()
 	}
 
-	return &Result{
+	result := &Result{
 		Stdout:   outBuf.String(),
 		Stderr:   errBuf.String(),
 		ExitCode: exitCode,
 		Err:      err,
 	}
+
+	switch {
+	case parent.Err() != nil:
+		result.ExitCode = -1
+		result.Err = context.Cause(parent)
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		result.ExitCode = -1
+		result.TimedOut = true
+		result.Err = fmt.Errorf("timed out after %s", timeout)
+	}
+
+	return result
 }
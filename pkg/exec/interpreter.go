@@ -0,0 +1,58 @@
+package exec
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// shells represents the interpreters known to run a snippet with `-c`.
+//
+//nolint:gochecknoglobals  // This is a constant list of known shells.
+var shells = []string{"sh", "bash", "zsh", "dash", "ksh", "mksh", "ash", "fish", "nu", "pwsh", "powershell"}
+
+// Invocation returns the arguments that run the snippet with the interpreter,
+// and whether the snippet is passed on standard input.
+//
+// The interpreter is a command line, such as "bash", "python3 -c" or "python3 -":
+//   - a bare shell runs the snippet with `-c`, other bare programs are rejected
+//   - a program with arguments receives the snippet as its last argument, such as `node -e`
+//   - a program whose last argument is `-` reads the snippet from standard input
+func Invocation(interpreter, snippet string) ([]string, bool, error) {
+	fields := strings.Fields(interpreter)
+	if len(fields) == 0 {
+		return nil, false, errors.New("interpreter is required")
+	}
+
+	if _, err := exec.LookPath(fields[0]); err != nil {
+		return nil, false, fmt.Errorf("interpreter %q is not installed: %w", fields[0], err)
+	}
+
+	program := filepath.Base(fields[0])
+	program = strings.TrimSuffix(program, filepath.Ext(program))
+
+	switch {
+	case len(fields) == 1 && slices.Contains(shells, program):
+		return append(fields, "-c", snippet), false, nil
+	case len(fields) == 1:
+		return nil, false, fmt.Errorf(
+			"interpreter %q is not a known shell, append the flag that runs the snippet (such as -c or -e), "+
+				"or - to read it from stdin",
+			interpreter,
+		)
+	case fields[len(fields)-1] == "-":
+		return fields, true, nil
+	default:
+		return append(fields, snippet), false, nil
+	}
+}
+
+// ReadsStdin reports whether the interpreter reads the snippet from standard input.
+func ReadsStdin(interpreter string) bool {
+	fields := strings.Fields(interpreter)
+
+	return len(fields) > 1 && fields[len(fields)-1] == "-"
+}
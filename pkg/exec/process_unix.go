@@ -0,0 +1,41 @@
+//go:build unix
+
+package exec
+
+import (
+	"errors"
+	"os/exec"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// setProcessGroup starts the command in its own process group, so that cancelling it signals the whole
+// process tree: SIGTERM first, then SIGKILL after the grace period.
+// The returned function must be called once the command was waited for, so that the SIGKILL
+// does not hit a process group that exited in time and whose ID may have been reused.
+func setProcessGroup(cmd *exec.Cmd, grace time.Duration) func() {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	var timer atomic.Pointer[time.Timer]
+
+	cmd.Cancel = func() error {
+		pgid := cmd.Process.Pid
+
+		timer.Store(time.AfterFunc(grace, func() {
+			_ = syscall.Kill(-pgid, syscall.SIGKILL)
+		}))
+
+		if err := syscall.Kill(-pgid, syscall.SIGTERM); err != nil && !errors.Is(err, syscall.ESRCH) {
+			return err //nolint:wrapcheck // Error is handled by exec.Cmd.
+		}
+
+		return nil
+	}
+
+	return func() {
+		if t := timer.Load(); t != nil {
+			t.Stop()
+		}
+	}
+}
@@ -0,0 +1,14 @@
+//go:build windows
+
+package exec
+
+import (
+	"os/exec"
+	"time"
+)
+
+// setProcessGroup keeps the default cancellation, which kills the process itself.
+// Process groups are not signalled on Windows, and WaitDelay still bounds waiting on descendants holding its output.
+func setProcessGroup(_ *exec.Cmd, _ time.Duration) func() {
+	return func() {}
+}
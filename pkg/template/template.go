@@ -3,20 +3,111 @@ package template
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"text/template"
 
 	sprig "github.com/go-task/slim-sprig/v3"
 )
 
+// Library represents a set of template files whose definitions (`{{ define "name" }}`)
+// are available to every document rendered through it.
+type Library struct {
+	// files are the paths of the parsed library files, in parse order.
+	files []string
+	// template holds the parsed definitions.
+	template *template.Template
+}
+
+// NewLibrary parses the given files into a new library.
+func NewLibrary(files ...string) (*Library, error) {
+	return (*Library)(nil).With(files...)
+}
+
+// With returns a new library holding the definitions of this library extended by those of the given files.
+// Files already part of the library are skipped, and definitions from later files replace earlier ones.
+func (l *Library) With(files ...string) (*Library, error) {
+	library := &Library{template: base()}
+
+	if l != nil {
+		clone, err := l.template.Clone()
+		if err != nil {
+			return nil, fmt.Errorf("cloning template library: %w", err)
+		}
+
+		library = &Library{files: slices.Clone(l.files), template: clone}
+	}
+
+	for _, file := range files {
+		file = filepath.ToSlash(file)
+
+		if slices.Contains(library.files, file) {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Clean(file))
+		if err != nil {
+			return nil, fmt.Errorf("loading template library: %w", err)
+		}
+
+		if _, err := library.template.New(file).Parse(string(data)); err != nil {
+			return nil, fmt.Errorf("parsing template library %q: %w", file, err)
+		}
+
+		library.files = append(library.files, file)
+	}
+
+	return library, nil
+}
+
+// Files returns the paths of the files the library was parsed from.
+func (l *Library) Files() []string {
+	if l == nil {
+		return nil
+	}
+
+	return slices.Clone(l.files)
+}
+
 // Apply executes a Go template with provided variables, returning an error if parsing fails or variables are missing.
-func Apply(templateString string, variables map[string]any) (string, error) {
-	template, err := template.New("cmd").
-		Funcs(sprig.FuncMap()).
-		Funcs(FuncMap()).
-		Option("missingkey=error").
-		Parse(templateString)
+// The definitions of the library can be used through `{{ template "name" . }}` or `{{ include "name" . }}`.
+// Leading and trailing whitespace is trimmed from the result.
+func (l *Library) Apply(templateString string, variables map[string]any) (string, error) {
+	rendered, err := l.Render(templateString, variables)
+
+	return strings.TrimSpace(rendered), err
+}
+
+// Render executes a Go template like Apply, but keeps the result as is, including surrounding whitespace.
+func (l *Library) Render(templateString string, variables map[string]any) (string, error) {
+	var (
+		tmpl *template.Template
+		err  error
+	)
+
+	if l == nil {
+		tmpl = base()
+	} else if tmpl, err = l.template.Clone(); err != nil {
+		return "", fmt.Errorf("cloning template library: %w", err)
+	}
+
+	tmpl.Funcs(map[string]any{
+		"include": func(name string, data any) (string, error) {
+			var buffer bytes.Buffer
+
+			if err := tmpl.ExecuteTemplate(&buffer, name, data); err != nil {
+				return "", err //nolint:wrapcheck // Error is already descriptive enough.
+			}
+
+			return buffer.String(), nil
+		},
+	})
+
+	document, err := tmpl.New("cmd").Parse(templateString)
 	if err != nil {
 		return "", err //nolint:wrapcheck // Error is already descriptive enough.
 	}
@@ -24,11 +115,30 @@ func Apply(templateString string, variables map[string]any) (string, error) {
 	// Execute the template with variables
 	var buffer bytes.Buffer
 
-	if err := template.Execute(&buffer, variables); err != nil {
+	if err := document.Execute(&buffer, variables); err != nil {
 		return "", errToMissingKey(err)
 	}
 
-	return strings.TrimSpace(buffer.String()), nil
+	return buffer.String(), nil
+}
+
+// Apply executes a Go template with provided variables, returning an error if parsing fails or variables are missing.
+func Apply(templateString string, variables map[string]any) (string, error) {
+	return (*Library)(nil).Apply(templateString, variables)
+}
+
+// base returns an empty template with all functions registered.
+func base() *template.Template {
+	return template.New("library").
+		Funcs(sprig.FuncMap()).
+		Funcs(FuncMap()).
+		Funcs(map[string]any{
+			// Placeholder to allow parsing, replaced for each execution in [Library.Apply].
+			"include": func(string, any) (string, error) {
+				return "", errors.New("include is not available outside of rendering")
+			},
+		}).
+		Option("missingkey=error")
 }
 
 // errToMissingKey formats the original error from text/template to a friendler one.